@@ -0,0 +1,273 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/miekg/dns"
+)
+
+// Input formats.
+const (
+	formatAuto      = "auto"
+	formatBinary    = "binary"
+	formatHex       = "hex"
+	formatBase64    = "base64"
+	formatBase64URL = "base64url"
+	formatDoH       = "doh"
+)
+
+// Framings.
+const (
+	framingAuto = "auto"
+	framingNone = "none"
+	framingTCP  = "tcp"
+)
+
+// decodeInput decodes input in the given format, detecting it if format is
+// formatAuto.
+func decodeInput(input []byte, format string) ([]byte, error) {
+	if format == formatAuto {
+		format = detectFormat(input)
+	}
+	text := strings.TrimSpace(string(input))
+	var data []byte
+	var err error
+	switch format {
+	case formatBinary:
+		data = input
+	case formatHex:
+		data, err = decodeHex(text)
+	case formatBase64:
+		data, err = decodeBase64(base64.RawStdEncoding, text)
+	case formatBase64URL:
+		data, err = decodeBase64(base64.RawURLEncoding, text)
+	case formatDoH:
+		data, err = decodeDoH(text)
+	default:
+		return nil, fmt.Errorf("unknown format %q", format)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("decoding %s: %s", format, err)
+	}
+	return data, nil
+}
+
+// detectFormat guesses the format of input. Anything that isn't printable
+// text is binary. Text that looks like hex, a hex dump or just hex digits,
+// is taken as hex in preference to base64, which it may also be valid as,
+// so that a mistake in it is reported as a hex error.
+func detectFormat(input []byte) string {
+	if !utf8.Valid(input) {
+		return formatBinary
+	}
+	text := strings.TrimSpace(string(input))
+	if text == "" {
+		return formatBinary
+	}
+	for _, r := range text {
+		if !unicode.IsPrint(r) && !unicode.IsSpace(r) {
+			return formatBinary
+		}
+	}
+	if strings.Contains(text, "://") || strings.Contains(text, "dns=") {
+		return formatDoH
+	}
+	if looksLikeHex(text) {
+		return formatHex
+	}
+	if strings.ContainsAny(text, "-_") {
+		return formatBase64URL
+	}
+	return formatBase64
+}
+
+// looksLikeHex reports whether text has a line of a hex dump, or is made up
+// only of hex digits and the separators decodeHex ignores.
+func looksLikeHex(text string) bool {
+	for _, line := range strings.Split(text, "\n") {
+		if _, ok := dumpHex(strings.TrimSpace(line)); ok {
+			return true
+		}
+	}
+	for _, field := range strings.Fields(text) {
+		field = strings.TrimPrefix(strings.TrimPrefix(field, "0x"), "0X")
+		if strings.Trim(field, "0123456789abcdefABCDEF:") != "" {
+			return false
+		}
+	}
+	return true
+}
+
+var (
+	// hexOffset matches the offset at the start of a line of tcpdump -x or
+	// -X output, or of xxd output.
+	hexOffset = regexp.MustCompile(`^(0x)?[0-9a-fA-F]+:\s+`)
+	// hexdumpLine matches a line of hexdump -C output.
+	hexdumpLine = regexp.MustCompile(`^[0-9a-fA-F]{8}(\s+[0-9a-fA-F]{2})+\s+\|`)
+)
+
+// dumpHex returns the hex part of a line of tcpdump -x or -X, xxd or
+// hexdump -C output, without its offset and ASCII column, and false if line
+// is not one.
+func dumpHex(line string) (string, bool) {
+	if hexOffset.MatchString(line) {
+		// The ASCII column follows the hex after two spaces.
+		line = hexOffset.ReplaceAllString(line, "")
+		if i := strings.Index(line, "  "); i >= 0 {
+			line = line[:i]
+		}
+		return line, true
+	}
+	if hexdumpLine.MatchString(line) {
+		line = line[:strings.Index(line, "|")]
+		return strings.TrimPrefix(line, strings.Fields(line)[0]), true
+	}
+	return "", false
+}
+
+// decodeHex decodes hex digits, ignoring whitespace, colons and "0x"
+// prefixes. If text is a hex dump, as printed by tcpdump -x or -X, xxd or
+// hexdump -C, only the hex of its dump lines is used, so that tcpdump's
+// summary lines and hexdump's final offset are skipped.
+func decodeHex(text string) ([]byte, error) {
+	lines := strings.Split(text, "\n")
+	dump := false
+	for _, line := range lines {
+		if _, ok := dumpHex(strings.TrimSpace(line)); ok {
+			dump = true
+		}
+	}
+	var digits strings.Builder
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if dump {
+			var ok bool
+			if line, ok = dumpHex(line); !ok {
+				continue
+			}
+		}
+		for _, field := range strings.Fields(line) {
+			field = strings.TrimPrefix(strings.TrimPrefix(field, "0x"), "0X")
+			for _, r := range field {
+				switch {
+				case r == ':':
+				case strings.ContainsRune("0123456789abcdefABCDEF", r):
+					digits.WriteRune(r)
+				default:
+					return nil, fmt.Errorf("invalid hex character %q", r)
+				}
+			}
+		}
+	}
+	if digits.Len()%2 != 0 {
+		return nil, fmt.Errorf("odd number of hex digits (%d)", digits.Len())
+	}
+	return hex.DecodeString(digits.String())
+}
+
+// decodeBase64 decodes text with enc, ignoring whitespace and padding.
+func decodeBase64(enc *base64.Encoding, text string) ([]byte, error) {
+	text = strings.Join(strings.Fields(text), "")
+	return enc.DecodeString(strings.TrimRight(text, "="))
+}
+
+// decodeDoH extracts the message from the dns parameter of a DNS-over-HTTPS
+// GET URL (RFC 8484 section 4.1), or from a bare query string.
+func decodeDoH(text string) ([]byte, error) {
+	query := text
+	if i := strings.Index(text, "?"); i >= 0 {
+		query = text[i+1:]
+	}
+	values, err := url.ParseQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	param := values.Get("dns")
+	if param == "" {
+		return nil, fmt.Errorf("no dns parameter")
+	}
+	return decodeBase64(base64.RawURLEncoding, param)
+}
+
+// stripHeaders returns the payload of data if it is an IPv4 or IPv6 packet
+// carrying UDP or TCP, as captured by tcpdump, and whether that payload is
+// TCP. Data is only taken to be a packet if the IP length field matches its
+// length, so DNS messages are returned unchanged.
+func stripHeaders(data []byte) ([]byte, bool) {
+	var proto byte
+	var payload []byte
+	switch {
+	case len(data) >= 20 && data[0]>>4 == 4:
+		headerLen := int(data[0]&0x0f) * 4
+		if headerLen < 20 || int(binary.BigEndian.Uint16(data[2:])) != len(data) || len(data) < headerLen {
+			return data, false
+		}
+		proto, payload = data[9], data[headerLen:]
+	case len(data) >= 40 && data[0]>>4 == 6:
+		if int(binary.BigEndian.Uint16(data[4:]))+40 != len(data) {
+			return data, false
+		}
+		proto, payload = data[6], data[40:]
+	default:
+		return data, false
+	}
+	switch {
+	case proto == 17 && len(payload) >= 8:
+		return payload[8:], false
+	case proto == 6 && len(payload) >= 20 && len(payload) >= int(payload[12]>>4)*4:
+		return payload[int(payload[12]>>4)*4:], true
+	}
+	return data, false
+}
+
+// splitMessages splits data into DNS messages according to framing. With
+// framingTCP, each message is preceded by its length in two bytes (RFC 1035
+// section 4.2.2). With framingAuto, data is treated as TCP framed only if it
+// divides exactly into frames that each hold a valid message.
+func splitMessages(data []byte, framing string) ([][]byte, error) {
+	switch framing {
+	case framingNone:
+		return [][]byte{data}, nil
+	case framingTCP:
+		return splitFrames(data)
+	case framingAuto:
+		frames, err := splitFrames(data)
+		if err != nil {
+			return [][]byte{data}, nil
+		}
+		for _, frame := range frames {
+			if err := new(dns.Msg).Unpack(frame); err != nil {
+				return [][]byte{data}, nil
+			}
+		}
+		return frames, nil
+	}
+	return nil, fmt.Errorf("unknown framing %q", framing)
+}
+
+func splitFrames(data []byte) ([][]byte, error) {
+	var frames [][]byte
+	for len(data) > 0 {
+		if len(data) < 2 {
+			return nil, fmt.Errorf("truncated length prefix")
+		}
+		n := int(binary.BigEndian.Uint16(data))
+		if len(data) < 2+n {
+			return nil, fmt.Errorf("frame of %d bytes truncated to %d", n, len(data)-2)
+		}
+		frames = append(frames, data[2:2+n])
+		data = data[2+n:]
+	}
+	if len(frames) == 0 {
+		return nil, fmt.Errorf("no messages")
+	}
+	return frames, nil
+}
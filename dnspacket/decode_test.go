@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+// queryHex is an A query for example.com with ID 0x1234 and RD set.
+const queryHex = "123401000001000000000000076578616d706c6503636f6d0000010001"
+
+// queryPacket is the query in a UDP packet, as captured by tcpdump -X, with
+// the summary line tcpdump prints before it.
+const queryPacket = `12:00:00.000000 IP 10.0.0.1.53000 > 10.0.0.2.53: 4660+ A? example.com. (29)
+	0x0000:  4500 0039 0000 0000 4011 0000 0a00 0001  E..9....@.......
+	0x0010:  0a00 0002 cf08 0035 0025 0000 1234 0100  .......5.%...4..
+	0x0020:  0001 0000 0000 0000 0765 7861 6d70 6c65  .........example
+	0x0030:  0363 6f6d 0000 0100 01                   .com.....
+`
+
+func query(t *testing.T) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(queryHex)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestDetectFormat(t *testing.T) {
+	testCases := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"binary", string(query(t)), formatBinary},
+		{"empty", "", formatBinary},
+		{"hex", queryHex, formatHex},
+		{"hex with colons", "12:34:01:00", formatHex},
+		{"hex with 0x", "0x1234 0x0100", formatHex},
+		{"odd hex", "123", formatHex},
+		{"tcpdump", queryPacket, formatHex},
+		{"xxd", "00000000: 1234 0100 0001 0000 0000 0000 0765 7861  .4...........exa", formatHex},
+		{"hexdump -C", "00000000  12 34 01 00 00 01 00 00  00 00 00 00 07 65 78 61  |.4...........exa|", formatHex},
+		{"base64", "EjQBAAABAAAAAAAAB2V4YW1wbGUDY29tAAABAAE=", formatBase64},
+		{"base64url", "q83vAAABAAAAAAAAB2V4YW1wbGUDY29tAAAB_-8", formatBase64URL},
+		{"DoH URL", "https://dns.example/dns-query?dns=EjQBAAABAAAAAAAAB2V4YW1wbGUDY29tAAABAAE", formatDoH},
+		{"DoH query", "dns=EjQBAAABAAAAAAAAB2V4YW1wbGUDY29tAAABAAE", formatDoH},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := detectFormat([]byte(tc.input)); got != tc.want {
+				t.Errorf("detectFormat(%q) = %s, want %s", tc.input, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestDecodeHex(t *testing.T) {
+	packet, err := hex.DecodeString("450000390000000040110000" + "0a0000010a000002" + "cf08003500250000" + queryHex)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testCases := []struct {
+		name    string
+		input   string
+		want    []byte
+		wantErr bool
+	}{
+		{"plain", queryHex, query(t), false},
+		{"upper case", "1234ABCD", []byte{0x12, 0x34, 0xab, 0xcd}, false},
+		{"spaces and newlines", "12 34\n01 00", []byte{0x12, 0x34, 0x01, 0x00}, false},
+		{"colons", "12:34:01:00", []byte{0x12, 0x34, 0x01, 0x00}, false},
+		{"0x prefixes", "0x12 0x34 0X0100", []byte{0x12, 0x34, 0x01, 0x00}, false},
+		{"tcpdump -X with summary", queryPacket, packet, false},
+		{"tcpdump -x", "\t0x0000:  1234 0100\n\t0x0004:  0001", []byte{0x12, 0x34, 0x01, 0x00, 0x00, 0x01}, false},
+		{"xxd", "00000000: 1234 0100 0001  .4....\n", []byte{0x12, 0x34, 0x01, 0x00, 0x00, 0x01}, false},
+		{"hexdump -C", "00000000  12 34 01 00 00 01  |.4....|\n00000006\n", []byte{0x12, 0x34, 0x01, 0x00, 0x00, 0x01}, false},
+		{"odd digits", "123", nil, true},
+		{"invalid character", "12 3g", nil, true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := decodeHex(tc.input)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("got error %v, want error %t", err, tc.wantErr)
+			}
+			if !bytes.Equal(got, tc.want) {
+				t.Errorf("got %x, want %x", got, tc.want)
+			}
+		})
+	}
+}
+
+func TestDecodeInput(t *testing.T) {
+	testCases := []struct {
+		name    string
+		input   string
+		wantErr bool
+	}{
+		{"hex", queryHex, false},
+		{"base64", "EjQBAAABAAAAAAAAB2V4YW1wbGUDY29tAAABAAE=", false},
+		{"base64 unpadded", "EjQBAAABAAAAAAAAB2V4YW1wbGUDY29tAAABAAE", false},
+		{"DoH URL", "https://dns.example/dns-query?ct&dns=EjQBAAABAAAAAAAAB2V4YW1wbGUDY29tAAABAAE", false},
+		{"odd hex is a hex error", queryHex[1:], true},
+		{"DoH without dns", "https://dns.example/dns-query?x=1", true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := decodeInput([]byte(tc.input), formatAuto)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("got error %v, want error %t", err, tc.wantErr)
+			}
+			if !tc.wantErr && !bytes.Equal(got, query(t)) {
+				t.Errorf("got %x, want %x", got, query(t))
+			}
+		})
+	}
+}
+
+func TestStripHeaders(t *testing.T) {
+	data, err := decodeHex(queryPacket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload, tcp := stripHeaders(data)
+	if tcp || !bytes.Equal(payload, query(t)) {
+		t.Errorf("got %x, tcp %t, want %x over UDP", payload, tcp, query(t))
+	}
+	if payload, _ := stripHeaders(query(t)); !bytes.Equal(payload, query(t)) {
+		t.Errorf("a bare message was changed to %x", payload)
+	}
+}
@@ -0,0 +1,401 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/miekg/dns"
+)
+
+// parseMessages parses text as one or more DNS messages. Text containing a
+// section header is in presentation form, as printed by dig or by dnspacket
+// itself, and may hold several messages each introduced by a ";; message"
+// line. Otherwise each non-empty line is a spec for a query: a name,
+// optionally followed by a type, a class and dig-style options:
+//
+//	example.com. CAA +dnssec +edns=1232
+//
+// The options are +dnssec (set the DO bit), +edns[=size] (add an OPT record
+// with the given UDP payload size, 1232 by default), +noedns, +norec,
+// +cd, +ad, +nsid and +id=N.
+func parseMessages(text string) ([]*dns.Msg, error) {
+	if !strings.Contains(text, "SECTION:") && !strings.Contains(text, "opcode:") {
+		var msgs []*dns.Msg
+		for _, line := range strings.Split(text, "\n") {
+			if fields := strings.Fields(line); len(fields) > 0 {
+				msg, err := parseSpec(fields)
+				if err != nil {
+					return nil, fmt.Errorf("%q: %s", line, err)
+				}
+				msgs = append(msgs, msg)
+			}
+		}
+		if len(msgs) == 0 {
+			return nil, fmt.Errorf("no messages")
+		}
+		return msgs, nil
+	}
+
+	// dnspacket separates several messages with ";; message N of M".
+	var msgs []*dns.Msg
+	var lines []string
+	flush := func() error {
+		if strings.TrimSpace(strings.Join(lines, "")) == "" {
+			return nil
+		}
+		msg, err := parsePresentation(lines)
+		if err != nil {
+			return err
+		}
+		msgs, lines = append(msgs, msg), nil
+		return nil
+	}
+	for _, line := range strings.Split(text, "\n") {
+		if strings.HasPrefix(line, ";; message ") {
+			if err := flush(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+	return msgs, nil
+}
+
+// parseSpec parses the fields of a query spec.
+func parseSpec(fields []string) (*dns.Msg, error) {
+	msg := new(dns.Msg)
+	msg.RecursionDesired = true
+	qtype, qclass := dns.TypeA, uint16(dns.ClassINET)
+	var opt *dns.OPT
+	edns := func() *dns.OPT {
+		if opt == nil {
+			opt = newOPT(1232)
+		}
+		return opt
+	}
+	noEDNS := false
+	for _, field := range fields[1:] {
+		if !strings.HasPrefix(field, "+") {
+			if t, ok := parseType(field); ok {
+				qtype = t
+			} else if c, ok := dns.StringToClass[strings.ToUpper(field)]; ok {
+				qclass = c
+			} else {
+				return nil, fmt.Errorf("unknown type or class %q", field)
+			}
+			continue
+		}
+		name, value := field[1:], ""
+		if i := strings.Index(name, "="); i >= 0 {
+			name, value = name[:i], name[i+1:]
+		}
+		var n uint64
+		var err error
+		if value != "" {
+			if n, err = strconv.ParseUint(value, 10, 16); err != nil {
+				return nil, fmt.Errorf("invalid value in %s", field)
+			}
+		}
+		switch name {
+		case "dnssec", "do":
+			edns().SetDo()
+		case "edns", "bufsize":
+			if value != "" {
+				edns().SetUDPSize(uint16(n))
+			} else {
+				edns()
+			}
+		case "noedns":
+			noEDNS = true
+		case "rec":
+			msg.RecursionDesired = true
+		case "norec":
+			msg.RecursionDesired = false
+		case "cd":
+			msg.CheckingDisabled = true
+		case "ad":
+			msg.AuthenticatedData = true
+		case "nsid":
+			edns().Option = append(edns().Option, &dns.EDNS0_NSID{Code: dns.EDNS0NSID})
+		case "id":
+			msg.Id = uint16(n)
+		default:
+			return nil, fmt.Errorf("unknown option %s", field)
+		}
+	}
+	msg.Question = []dns.Question{{Name: dns.Fqdn(fields[0]), Qtype: qtype, Qclass: qclass}}
+	if opt != nil && !noEDNS {
+		msg.Extra = append(msg.Extra, opt)
+	}
+	return msg, nil
+}
+
+// parseType parses a type mnemonic or the generic TYPEnnn form.
+func parseType(s string) (uint16, bool) {
+	s = strings.ToUpper(s)
+	if t, ok := dns.StringToType[s]; ok {
+		return t, true
+	}
+	if strings.HasPrefix(s, "TYPE") {
+		if n, err := strconv.ParseUint(s[4:], 10, 16); err == nil {
+			return uint16(n), true
+		}
+	}
+	return 0, false
+}
+
+func newOPT(udpSize uint16) *dns.OPT {
+	opt := &dns.OPT{Hdr: dns.RR_Header{Name: ".", Rrtype: dns.TypeOPT}}
+	opt.SetUDPSize(udpSize)
+	return opt
+}
+
+var (
+	headerLine = regexp.MustCompile(`opcode: (\w+), status: (\w+), id: (\d+)`)
+	flagsLine  = regexp.MustCompile(`^;; flags:([^;]*);`)
+	ednsLine   = regexp.MustCompile(`^; EDNS: version:? (\d+)[,;] flags:([^;]*);(?: MBZ: 0x([0-9a-fA-F]+),)? udp: (\d+)`)
+	optionLine = regexp.MustCompile(`^; (NSID|COOKIE):\s*([0-9a-fA-F ]*)`)
+)
+
+// parsePresentation parses the lines of one message in presentation form.
+// Comment lines other than the header, flags, EDNS and question lines are
+// ignored, so the output of dig can be used as is. Of the EDNS options, only
+// NSID and COOKIE are understood.
+func parsePresentation(lines []string) (*dns.Msg, error) {
+	msg := new(dns.Msg)
+	var section *[]dns.RR
+	inQuestion := false
+	for _, line := range lines {
+		line = strings.TrimRight(line, " \t\r")
+		if line == "" {
+			continue
+		}
+		if strings.HasSuffix(line, "SECTION:") {
+			inQuestion, section = false, nil
+			switch {
+			case strings.Contains(line, "QUESTION") || strings.Contains(line, "ZONE"):
+				inQuestion = true
+			case strings.Contains(line, "ANSWER") || strings.Contains(line, "PREREQUISITE"):
+				section = &msg.Answer
+			case strings.Contains(line, "AUTHORITY") || strings.Contains(line, "UPDATE"):
+				section = &msg.Ns
+			case strings.Contains(line, "ADDITIONAL"):
+				section = &msg.Extra
+			}
+			continue
+		}
+		if m := headerLine.FindStringSubmatch(line); m != nil {
+			opcode, ok := dns.StringToOpcode[m[1]]
+			rcode, ok2 := dns.StringToRcode[m[2]]
+			id, err := strconv.ParseUint(m[3], 10, 16)
+			if !ok || !ok2 || err != nil {
+				return nil, fmt.Errorf("invalid header %q", line)
+			}
+			msg.Opcode, msg.Rcode, msg.Id = opcode, rcode, uint16(id)
+			continue
+		}
+		if m := flagsLine.FindStringSubmatch(line); m != nil {
+			if err := setFlags(msg, strings.Fields(m[1])); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if m := ednsLine.FindStringSubmatch(line); m != nil {
+			opt, err := parseEDNS(m)
+			if err != nil {
+				return nil, fmt.Errorf("invalid EDNS %q: %s", line, err)
+			}
+			msg.Extra = append(msg.Extra, opt)
+			continue
+		}
+		if m := optionLine.FindStringSubmatch(line); m != nil {
+			opt := msg.IsEdns0()
+			if opt == nil {
+				return nil, fmt.Errorf("%s option without EDNS", m[1])
+			}
+			value := strings.Replace(m[2], " ", "", -1)
+			if _, err := hex.DecodeString(value); err != nil {
+				return nil, fmt.Errorf("invalid %s %q", m[1], m[2])
+			}
+			if m[1] == "NSID" {
+				opt.Option = append(opt.Option, &dns.EDNS0_NSID{Code: dns.EDNS0NSID, Nsid: value})
+			} else {
+				opt.Option = append(opt.Option, &dns.EDNS0_COOKIE{Code: dns.EDNS0COOKIE, Cookie: value})
+			}
+			continue
+		}
+		if inQuestion && !strings.HasPrefix(line, ";;") {
+			q, err := parseQuestion(strings.TrimPrefix(line, ";"))
+			if err != nil {
+				return nil, err
+			}
+			msg.Question = append(msg.Question, q)
+			continue
+		}
+		if strings.HasPrefix(line, ";") {
+			continue
+		}
+		if section == nil {
+			return nil, fmt.Errorf("record outside a section: %q", line)
+		}
+		rr, err := dns.NewRR(line)
+		if err != nil {
+			return nil, err
+		}
+		*section = append(*section, rr)
+	}
+	if len(msg.Question) == 0 && msg.Id == 0 && len(msg.Answer) == 0 {
+		return nil, fmt.Errorf("no header, question or records")
+	}
+	return msg, nil
+}
+
+func setFlags(msg *dns.Msg, flags []string) error {
+	for _, flag := range flags {
+		switch flag {
+		case "qr":
+			msg.Response = true
+		case "aa":
+			msg.Authoritative = true
+		case "tc":
+			msg.Truncated = true
+		case "rd":
+			msg.RecursionDesired = true
+		case "ra":
+			msg.RecursionAvailable = true
+		case "z":
+			msg.Zero = true
+		case "ad":
+			msg.AuthenticatedData = true
+		case "cd":
+			msg.CheckingDisabled = true
+		default:
+			return fmt.Errorf("unknown flag %q", flag)
+		}
+	}
+	return nil
+}
+
+// parseEDNS builds an OPT record from a match of ednsLine.
+func parseEDNS(m []string) (*dns.OPT, error) {
+	udp, err := strconv.ParseUint(m[4], 10, 16)
+	if err != nil {
+		return nil, err
+	}
+	opt := newOPT(uint16(udp))
+	version, err := strconv.ParseUint(m[1], 10, 8)
+	if err != nil {
+		return nil, err
+	}
+	opt.SetVersion(uint8(version))
+	for _, flag := range strings.Fields(m[2]) {
+		switch flag {
+		case "do":
+			opt.SetDo()
+		case "co":
+			opt.SetCo()
+		default:
+			return nil, fmt.Errorf("unknown flag %q", flag)
+		}
+	}
+	if m[3] != "" {
+		z, err := strconv.ParseUint(m[3], 16, 16)
+		if err != nil {
+			return nil, err
+		}
+		opt.SetZ(uint16(z))
+	}
+	return opt, nil
+}
+
+// parseQuestion parses a question line, without its leading semicolon: a
+// name, class and type.
+func parseQuestion(line string) (dns.Question, error) {
+	fields := strings.Fields(line)
+	if len(fields) != 3 {
+		return dns.Question{}, fmt.Errorf("invalid question %q", line)
+	}
+	qclass, ok := dns.StringToClass[strings.ToUpper(fields[1])]
+	if !ok {
+		return dns.Question{}, fmt.Errorf("unknown class %q", fields[1])
+	}
+	qtype, ok := parseType(fields[2])
+	if !ok {
+		return dns.Question{}, fmt.Errorf("unknown type %q", fields[2])
+	}
+	return dns.Question{Name: dns.Fqdn(fields[0]), Qtype: qtype, Qclass: qclass}, nil
+}
+
+// encodeMessages packs msgs and writes them to w in the given format and
+// framing. With TCP framing the messages form one stream, encoded as a
+// whole; otherwise each is encoded separately, one per line for the text
+// formats. Unframed binary messages can't be told apart, so several of them
+// are TCP framed with framingAuto and refused with framingNone. dohURL is
+// the base URL for formatDoH.
+func encodeMessages(w io.Writer, msgs []*dns.Msg, format, framing, dohURL string) error {
+	var packed [][]byte
+	for _, msg := range msgs {
+		msg.Compress = true
+		data, err := msg.Pack()
+		if err != nil {
+			return err
+		}
+		packed = append(packed, data)
+	}
+	if format == formatBinary && len(packed) > 1 {
+		switch framing {
+		case framingAuto:
+			framing = framingTCP
+		case framingNone:
+			return fmt.Errorf("%d messages in binary need -framing tcp to be told apart", len(packed))
+		}
+	}
+	switch framing {
+	case framingTCP:
+		if format == formatDoH {
+			return fmt.Errorf("DNS-over-HTTPS does not use TCP framing")
+		}
+		var stream []byte
+		for _, data := range packed {
+			var length [2]byte
+			binary.BigEndian.PutUint16(length[:], uint16(len(data)))
+			stream = append(append(stream, length[:]...), data...)
+		}
+		packed = [][]byte{stream}
+	case framingNone, framingAuto:
+	default:
+		return fmt.Errorf("unknown framing %q", framing)
+	}
+	for _, data := range packed {
+		var err error
+		switch format {
+		case formatBinary:
+			_, err = w.Write(data)
+		case formatHex:
+			_, err = fmt.Fprintln(w, hex.EncodeToString(data))
+		case formatBase64:
+			_, err = fmt.Fprintln(w, base64.StdEncoding.EncodeToString(data))
+		case formatBase64URL:
+			_, err = fmt.Fprintln(w, base64.RawURLEncoding.EncodeToString(data))
+		case formatDoH:
+			_, err = fmt.Fprintln(w, dohURL+"?dns="+url.QueryEscape(base64.RawURLEncoding.EncodeToString(data)))
+		default:
+			return fmt.Errorf("unknown format %q", format)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
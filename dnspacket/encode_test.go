@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/miekg/dns"
+)
+
+// testMessages returns messages that between them use every part of the
+// presentation form parsePresentation understands.
+func testMessages(t *testing.T) []*dns.Msg {
+	t.Helper()
+	query := new(dns.Msg)
+	query.SetQuestion("example.com.", dns.TypeCAA)
+	query.Id = 1234
+	query.CheckingDisabled = true
+	opt := newOPT(1232)
+	opt.SetDo()
+	opt.Option = append(opt.Option,
+		&dns.EDNS0_NSID{Code: dns.EDNS0NSID},
+		&dns.EDNS0_COOKIE{Code: dns.EDNS0COOKIE, Cookie: "0102030405060708"})
+	query.Extra = append(query.Extra, opt)
+
+	response := new(dns.Msg)
+	response.SetReply(query)
+	response.Authoritative = true
+	response.RecursionAvailable = true
+	response.Rcode = dns.RcodeSuccess
+	for _, s := range []string{
+		"example.com. 300 IN CAA 0 issue \"ca.example\"",
+		"example.com. 300 IN A 192.0.2.1",
+		"example.com. 300 IN AAAA 2001:db8::1",
+		"example.com. 300 IN TXT \"two\" \"strings\"",
+	} {
+		response.Answer = append(response.Answer, mustRR(t, s))
+	}
+	response.Ns = []dns.RR{mustRR(t, "example.com. 3600 IN NS ns.example.com.")}
+	response.Extra = append([]dns.RR{mustRR(t, "ns.example.com. 3600 IN A 192.0.2.53")}, response.Extra...)
+
+	nxdomain := new(dns.Msg)
+	nxdomain.SetQuestion("missing.example.", dns.TypeA)
+	nxdomain.Response = true
+	nxdomain.Rcode = dns.RcodeNameError
+	nxdomain.Id = 7
+	nxdomain.Ns = []dns.RR{mustRR(t, "example. 900 IN SOA ns.example. admin.example. 1 7200 900 1209600 86400")}
+
+	return []*dns.Msg{query, response, nxdomain}
+}
+
+func mustRR(t *testing.T, s string) dns.RR {
+	t.Helper()
+	rr, err := dns.NewRR(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rr
+}
+
+// TestParsePresentationRoundTrip checks that messages printed the way
+// dnspacket prints them parse back to the same wire format.
+func TestParsePresentationRoundTrip(t *testing.T) {
+	for _, msg := range testMessages(t) {
+		want, err := msg.Pack()
+		if err != nil {
+			t.Fatal(err)
+		}
+		parsed, err := parsePresentation(strings.Split(msg.String(), "\n"))
+		if err != nil {
+			t.Fatalf("parsing %s: %s", msg, err)
+		}
+		got, err := parsed.Pack()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("round trip of\n%s\ngave\n%s", msg, parsed)
+		}
+	}
+}
+
+func TestParseMessages(t *testing.T) {
+	msgs := testMessages(t)
+	var text strings.Builder
+	for i, msg := range msgs {
+		fmt.Fprintf(&text, ";; message %d of %d\n%s\n", i+1, len(msgs), msg)
+	}
+	parsed, err := parseMessages(text.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(parsed) != len(msgs) {
+		t.Fatalf("got %d messages, want %d", len(parsed), len(msgs))
+	}
+	for i := range msgs {
+		if parsed[i].String() != msgs[i].String() {
+			t.Errorf("message %d: got\n%s\nwant\n%s", i+1, parsed[i], msgs[i])
+		}
+	}
+}
+
+func TestParseSpec(t *testing.T) {
+	testCases := []struct {
+		spec    string
+		want    string
+		wantErr bool
+	}{
+		{"example.com", "example.com.\tIN\t A", false},
+		{"example.com. CAA +dnssec +edns=1232", "example.com.\tIN\t CAA", false},
+		{"example.com TYPE65 CH +norec", "example.com.\tCH\t HTTPS", false},
+		{"example.com BOGUS", "", true},
+		{"example.com +bogus", "", true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.spec, func(t *testing.T) {
+			msgs, err := parseMessages(tc.spec)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("got error %v, want error %t", err, tc.wantErr)
+			}
+			if tc.wantErr {
+				return
+			}
+			if got := msgs[0].Question[0].String(); got != ";"+tc.want {
+				t.Errorf("got question %q, want %q", got, ";"+tc.want)
+			}
+		})
+	}
+}
+
+// TestEncodeMessages checks that encoded messages decode to what was
+// encoded, in every format and framing that can hold them.
+func TestEncodeMessages(t *testing.T) {
+	msgs := testMessages(t)
+	for _, format := range []string{formatBinary, formatHex, formatBase64, formatBase64URL, formatDoH} {
+		for _, framing := range []string{framingAuto, framingNone, framingTCP} {
+			var out bytes.Buffer
+			err := encodeMessages(&out, msgs, format, framing, "https://dns.example/dns-query")
+			if format == formatDoH && framing == framingTCP || format == formatBinary && framing == framingNone {
+				if err == nil {
+					t.Errorf("%s with framing %s: no error", format, framing)
+				}
+				continue
+			}
+			if err != nil {
+				t.Fatalf("%s with framing %s: %s", format, framing, err)
+			}
+			// The text formats put each message, or the TCP stream, on
+			// a line of its own.
+			chunks := [][]byte{out.Bytes()}
+			if format != formatBinary {
+				chunks = bytes.Split(bytes.TrimSpace(out.Bytes()), []byte("\n"))
+			}
+			var got []*dns.Msg
+			for _, chunk := range chunks {
+				data, err := decodeInput(chunk, format)
+				if err != nil {
+					t.Fatalf("%s with framing %s: %s", format, framing, err)
+				}
+				split, err := splitMessages(data, framingAuto)
+				if err != nil {
+					t.Fatal(err)
+				}
+				for _, m := range split {
+					msg := new(dns.Msg)
+					if err := msg.Unpack(m); err != nil {
+						t.Fatalf("%s with framing %s: %s", format, framing, err)
+					}
+					got = append(got, msg)
+				}
+			}
+			if len(got) != len(msgs) {
+				t.Fatalf("%s with framing %s: got %d messages, want %d", format, framing, len(got), len(msgs))
+			}
+			for i := range msgs {
+				if got[i].String() != msgs[i].String() {
+					t.Errorf("%s with framing %s: message %d changed to\n%s", format, framing, i+1, got[i])
+				}
+			}
+		}
+	}
+}
@@ -1,31 +1,84 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"io/ioutil"
 	"log"
 	"os"
+	"strings"
 
 	"github.com/miekg/dns"
 )
 
-// Read a binary DNS packet from stdin and print it in standard display form.
+var format = flag.String("format", formatAuto, "Input format, or output format with -encode: auto, binary, hex, base64, base64url or doh (a DNS-over-HTTPS GET URL)")
+var framing = flag.String("framing", framingAuto, "Message framing: auto, none, or tcp (each message preceded by a two-byte length)")
+var encode = flag.Bool("encode", false, "Read messages in presentation form, or query specs like \"example.com. CAA +dnssec +edns=1232\", and write them in wire format")
+var dohURL = flag.String("doh-url", "https://dns.example/dns-query", "Base URL for -encode -format doh")
+
+// Read a DNS packet from stdin, or from the arguments, and print it in
+// standard display form. The packet may be binary, hex (including tcpdump's
+// output, IP headers and all), base64, base64url or a DNS-over-HTTPS GET URL,
+// and may hold several TCP-framed messages.
+//
+// With -encode, do the reverse: read messages in presentation form, as
+// printed by dig or dnspacket, or query specs, and write them in wire format
+// as binary, hex, base64, base64url or DNS-over-HTTPS GET URLs. With
+// -format auto, that is binary unless stdout is a terminal, and hex if it
+// is.
 func main() {
+	flag.Parse()
 	err := main2()
 	if err != nil {
 		log.Fatal(err)
 	}
 }
 func main2() error {
-	body, err := ioutil.ReadAll(os.Stdin)
+	var body []byte
+	var err error
+	if flag.NArg() > 0 {
+		body = []byte(strings.Join(flag.Args(), " "))
+	} else {
+		body, err = ioutil.ReadAll(os.Stdin)
+		if err != nil {
+			return err
+		}
+	}
+	if *encode {
+		msgs, err := parseMessages(string(body))
+		if err != nil {
+			return err
+		}
+		if *format == formatAuto {
+			*format = formatBinary
+			if info, err := os.Stdout.Stat(); err == nil && info.Mode()&os.ModeCharDevice != 0 {
+				*format = formatHex
+			}
+		}
+		return encodeMessages(os.Stdout, msgs, *format, *framing, *dohURL)
+	}
+	data, err := decodeInput(body, *format)
 	if err != nil {
 		return err
 	}
-	msg := new(dns.Msg)
-	err = msg.Unpack(body)
+	data, tcp := stripHeaders(data)
+	if tcp && *framing == framingAuto {
+		*framing = framingTCP
+	}
+	messages, err := splitMessages(data, *framing)
 	if err != nil {
 		return err
 	}
-	fmt.Println(msg)
+	for i, m := range messages {
+		if len(messages) > 1 {
+			fmt.Printf(";; message %d of %d\n", i+1, len(messages))
+		}
+		msg := new(dns.Msg)
+		err = msg.Unpack(m)
+		if err != nil {
+			return err
+		}
+		fmt.Println(msg)
+	}
 	return nil
 }
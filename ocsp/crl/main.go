@@ -0,0 +1,269 @@
+// crl fetches the CRLs listed in certificates' CRL Distribution Points,
+// reports whether each certificate is on them, lints the CRLs' validity
+// periods, and cross-checks the answer against OCSP so that disagreements
+// between the two revocation channels are flagged.
+package main
+
+import (
+	"crypto/x509"
+	"encoding/pem"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jsha/go/ocsp/helper"
+	"golang.org/x/crypto/ocsp"
+)
+
+var options = helper.RegisterFlags(flag.CommandLine)
+var crlURL = flag.String("crl", "", "URL or file of the CRL to use instead of the certificates' CRL Distribution Points")
+var serial = flag.String("serial", "", "Look up this serial number, issued by -issuer, on -crl instead of checking files")
+var serialBase = flag.Int("serial-base", 16, "Base of -serial (16 or 10)")
+var noOCSP = flag.Bool("no-ocsp", false, "Don't cross-check against OCSP")
+var maxValidity = flag.Duration("max-validity", 10*24*time.Hour, "Longest acceptable thisUpdate to nextUpdate interval")
+
+// clockSkew is how far in the future thisUpdate may be before it is
+// reported.
+const clockSkew = 5 * time.Minute
+
+func main() {
+	flag.Parse()
+	opts, err := options()
+	if err != nil {
+		log.Fatal(err)
+	}
+	checker := helper.New(opts)
+	client := &http.Client{Timeout: opts.Timeout}
+	if client.Timeout == 0 {
+		client.Timeout = 5 * time.Second
+	}
+	var errors bool
+	if *serial != "" {
+		if err := checkSerial(checker, client, opts); err != nil {
+			log.Printf("error for %s: %s\n", *serial, err)
+			errors = true
+		}
+	}
+	for _, f := range flag.Args() {
+		if err := checkFile(checker, client, f); err != nil {
+			log.Printf("error for %s: %s\n", f, err)
+			errors = true
+		}
+	}
+	if errors {
+		os.Exit(1)
+	}
+}
+
+func checkSerial(checker *helper.Checker, client *http.Client, opts helper.Options) error {
+	n, err := helper.ParseSerial(*serial, *serialBase)
+	if err != nil {
+		return err
+	}
+	if len(opts.Issuers) == 0 || *crlURL == "" {
+		return fmt.Errorf("-serial requires -issuer and -crl")
+	}
+	issuer := opts.Issuers[0]
+	crl, entry, err := lookup(client, *crlURL, n, issuer)
+	if crl == nil || *noOCSP {
+		return err
+	}
+	if opts.URLOverride == "" {
+		fmt.Printf("Not cross-checking OCSP: no -url for the responder\n")
+		return err
+	}
+	result, ocspErr := checker.CheckSerial(n, issuer)
+	if diffErr := crossCheck(entry, result, ocspErr); diffErr != nil {
+		return diffErr
+	}
+	return err
+}
+
+func checkFile(checker *helper.Checker, client *http.Client, f string) error {
+	certs, err := helper.ReadCertificates(f)
+	if err != nil {
+		return fmt.Errorf("parsing certificate: %s", err)
+	}
+	cert := certs[0]
+	fmt.Printf("Certificate %s serial %036x\n", cert.Subject, cert.SerialNumber)
+	urls := cert.CRLDistributionPoints
+	if *crlURL != "" {
+		urls = []string{*crlURL}
+	}
+	if len(urls) == 0 {
+		return fmt.Errorf("no CRL distribution points in cert")
+	}
+
+	// The issuer is needed to verify the CRL's signature whether or not
+	// OCSP is checked, or succeeds.
+	issuer, err := checker.Issuer(certs)
+	if err != nil {
+		return fmt.Errorf("getting issuer: %s", err)
+	}
+	var result *helper.Result
+	var ocspErr error
+	if !*noOCSP {
+		result, ocspErr = checker.CheckWithIssuer(cert, issuer)
+	}
+
+	var errs []string
+	for _, u := range urls {
+		crl, entry, err := lookup(client, u, cert.SerialNumber, issuer)
+		if err != nil {
+			errs = append(errs, err.Error())
+		}
+		if crl == nil || *noOCSP {
+			continue
+		}
+		if err := crossCheck(entry, result, ocspErr); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// lookup fetches and lints the CRL at u, verifies its signature against
+// issuer, and reports whether serial is on it. The
+// returned entry is nil if serial is not revoked. The CRL is returned if it
+// could be parsed, even if linting it found problems.
+func lookup(client *http.Client, u string, serial *big.Int, issuer *x509.Certificate) (*x509.RevocationList, *x509.RevocationListEntry, error) {
+	fmt.Printf("Fetching CRL %s\n", u)
+	crl, err := fetchCRL(client, u)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %s", u, err)
+	}
+	fmt.Printf("  Issuer %s\n", crl.Issuer)
+	if crl.Number != nil {
+		fmt.Printf("  CRLNumber %s\n", crl.Number)
+	}
+	fmt.Printf("  ThisUpdate %s\n", crl.ThisUpdate)
+	fmt.Printf("  NextUpdate %s\n", crl.NextUpdate)
+	fmt.Printf("  Entries %d\n", len(crl.RevokedCertificateEntries))
+
+	var problems []string
+	if err := crl.CheckSignatureFrom(issuer); err != nil {
+		problems = append(problems, fmt.Sprintf("signature: %s", err))
+	} else {
+		fmt.Printf("  Signature valid for issuer %s\n", issuer.Subject)
+	}
+	problems = append(problems, lint(crl)...)
+	for _, p := range problems {
+		fmt.Printf("  Problem %s\n", p)
+	}
+
+	var entry *x509.RevocationListEntry
+	for i := range crl.RevokedCertificateEntries {
+		if crl.RevokedCertificateEntries[i].SerialNumber.Cmp(serial) == 0 {
+			entry = &crl.RevokedCertificateEntries[i]
+			break
+		}
+	}
+	if entry == nil {
+		fmt.Printf("  Serial %036x not present\n", serial)
+	} else {
+		fmt.Printf("  Serial %036x revoked at %s reason %d\n", serial, entry.RevocationTime, entry.ReasonCode)
+	}
+	if len(problems) > 0 {
+		return crl, entry, fmt.Errorf("%s: %s", u, strings.Join(problems, "; "))
+	}
+	return crl, entry, nil
+}
+
+// lint returns a description of each problem with crl's validity period.
+func lint(crl *x509.RevocationList) []string {
+	var problems []string
+	now := time.Now()
+	if ahead := crl.ThisUpdate.Sub(now); ahead > clockSkew {
+		problems = append(problems, fmt.Sprintf("thisUpdate is %s in the future", ahead))
+	}
+	if crl.NextUpdate.IsZero() {
+		problems = append(problems, "no nextUpdate")
+		return problems
+	}
+	if crl.NextUpdate.Before(now) {
+		problems = append(problems, fmt.Sprintf("stale: nextUpdate was %s ago", now.Sub(crl.NextUpdate).Truncate(time.Second)))
+	}
+	validity := crl.NextUpdate.Sub(crl.ThisUpdate)
+	if validity <= 0 {
+		problems = append(problems, "nextUpdate is not after thisUpdate")
+	} else if *maxValidity > 0 && validity > *maxValidity {
+		problems = append(problems, fmt.Sprintf("validity interval %s exceeds %s", validity, *maxValidity))
+	}
+	return problems
+}
+
+// fetchCRL reads a CRL in DER or PEM from a URL or, if u is not an HTTP
+// URL, from a file.
+func fetchCRL(client *http.Client, u string) (*x509.RevocationList, error) {
+	var body []byte
+	var err error
+	if strings.HasPrefix(u, "http://") || strings.HasPrefix(u, "https://") {
+		var resp *http.Response
+		resp, err = client.Get(u)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		body, err = ioutil.ReadAll(resp.Body)
+		if err == nil && resp.StatusCode != 200 {
+			err = fmt.Errorf("http status code %d", resp.StatusCode)
+		}
+	} else {
+		body, err = ioutil.ReadFile(u)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if block, _ := pem.Decode(body); block != nil {
+		body = block.Bytes
+	}
+	crl, err := x509.ParseRevocationList(body)
+	if err != nil {
+		return nil, fmt.Errorf("parsing CRL: %s", err)
+	}
+	return crl, nil
+}
+
+// crossCheck compares the CRL's answer, entry, with the OCSP result and
+// returns an error describing any disagreement.
+func crossCheck(entry *x509.RevocationListEntry, result *helper.Result, ocspErr error) error {
+	if result == nil || result.Response == nil {
+		fmt.Printf("  OCSP unavailable: %s\n", ocspErr)
+		return nil
+	}
+	resp := result.Response
+	fmt.Printf("  OCSP %s says %s\n", result.Server, helper.StatusString(resp.Status))
+	var diffs []string
+	switch {
+	case entry == nil && resp.Status == ocsp.Revoked:
+		diffs = append(diffs, fmt.Sprintf("OCSP says revoked at %s but the CRL does not list it", resp.RevokedAt))
+	case entry != nil && resp.Status != ocsp.Revoked:
+		diffs = append(diffs, fmt.Sprintf("CRL says revoked at %s but OCSP says %s",
+			entry.RevocationTime, helper.StatusString(resp.Status)))
+	case entry != nil:
+		if !entry.RevocationTime.Truncate(time.Second).Equal(resp.RevokedAt.Truncate(time.Second)) {
+			diffs = append(diffs, fmt.Sprintf("revocation time %s on CRL, %s from OCSP",
+				entry.RevocationTime, resp.RevokedAt))
+		}
+		if entry.ReasonCode != resp.RevocationReason {
+			diffs = append(diffs, fmt.Sprintf("reason %d on CRL, %d from OCSP",
+				entry.ReasonCode, resp.RevocationReason))
+		}
+	}
+	for _, d := range diffs {
+		fmt.Printf("  Disagreement %s\n", d)
+	}
+	if len(diffs) > 0 {
+		return fmt.Errorf("CRL and OCSP disagree: %s", strings.Join(diffs, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,308 @@
+package helper
+
+import (
+	"bytes"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+// DecodeInput turns the forms in which OCSP requests and responses are
+// commonly found into DER: raw DER, PEM, base64 (standard or URL-safe,
+// padded or not), or a GET URL whose last path segment is a URL-encoded
+// base64 request.
+func DecodeInput(input []byte) ([]byte, error) {
+	trimmed := bytes.TrimSpace(input)
+	if block, _ := pem.Decode(trimmed); block != nil {
+		return block.Bytes, nil
+	}
+	if len(input) > 0 && input[0] == 0x30 {
+		var raw asn1.RawValue
+		if rest, err := asn1.Unmarshal(input, &raw); err == nil && len(rest) == 0 {
+			return input, nil
+		}
+	}
+	text := string(trimmed)
+	if strings.HasPrefix(text, "http://") || strings.HasPrefix(text, "https://") {
+		u, err := url.Parse(text)
+		if err != nil {
+			return nil, err
+		}
+		path := u.EscapedPath()
+		text, err = url.PathUnescape(path[strings.LastIndex(path, "/")+1:])
+		if err != nil {
+			return nil, err
+		}
+	}
+	text = strings.Join(strings.Fields(text), "")
+	for _, enc := range []*base64.Encoding{
+		base64.StdEncoding, base64.RawStdEncoding, base64.URLEncoding, base64.RawURLEncoding,
+	} {
+		if der, err := enc.DecodeString(text); err == nil {
+			return der, nil
+		}
+	}
+	return nil, fmt.Errorf("input is not DER, PEM, base64 or an OCSP GET URL")
+}
+
+// IsRequest reports whether der looks like an OCSP request rather than a
+// response.
+func IsRequest(der []byte) bool {
+	var req decodedRequest
+	_, err := asn1.Unmarshal(der, &req)
+	return err == nil
+}
+
+type decodedRequest struct {
+	TBSRequest struct {
+		Version       int           `asn1:"explicit,tag:0,default:0,optional"`
+		RequestorName asn1.RawValue `asn1:"explicit,tag:1,optional"`
+		RequestList   []struct {
+			Cert       certID
+			Extensions []pkix.Extension `asn1:"explicit,tag:0,optional"`
+		}
+		RequestExtensions []pkix.Extension `asn1:"explicit,tag:2,optional"`
+	}
+	OptionalSignature asn1.RawValue `asn1:"explicit,tag:0,optional"`
+}
+
+// PrintRequest writes every field of the DER-encoded OCSP request der to w.
+// If issuer is non-nil, each CertID is checked against it.
+func PrintRequest(w io.Writer, der []byte, issuer *x509.Certificate) error {
+	var req decodedRequest
+	rest, err := asn1.Unmarshal(der, &req)
+	if err != nil {
+		return fmt.Errorf("parsing OCSP request: %s", err)
+	}
+	if len(rest) > 0 {
+		return fmt.Errorf("parsing OCSP request: %d bytes of trailing data", len(rest))
+	}
+	tbs := req.TBSRequest
+	fmt.Fprintf(w, "OCSP Request:\n")
+	fmt.Fprintf(w, "  Version %d\n", tbs.Version+1)
+	if len(tbs.RequestorName.FullBytes) > 0 {
+		fmt.Fprintf(w, "  RequestorName %x\n", tbs.RequestorName.Bytes)
+	}
+	for i, r := range tbs.RequestList {
+		fmt.Fprintf(w, "  Request %d:\n", i)
+		printCertID(w, "    ", r.Cert, issuer)
+		printExtensions(w, "    ", r.Extensions)
+	}
+	printExtensions(w, "  ", tbs.RequestExtensions)
+	if len(req.OptionalSignature.FullBytes) > 0 {
+		fmt.Fprintf(w, "  Signed (signature not verified)\n")
+	}
+	return nil
+}
+
+func printCertID(w io.Writer, indent string, id certID, issuer *x509.Certificate) {
+	hash := hashForOID(id.HashAlgorithm.Algorithm)
+	hashName := id.HashAlgorithm.Algorithm.String()
+	if hash != 0 {
+		hashName = hash.String()
+	}
+	fmt.Fprintf(w, "%sHashAlgorithm %s\n", indent, hashName)
+	fmt.Fprintf(w, "%sIssuerNameHash %x\n", indent, id.IssuerNameHash)
+	fmt.Fprintf(w, "%sIssuerKeyHash %x\n", indent, id.IssuerKeyHash)
+	fmt.Fprintf(w, "%sSerialNumber %036x\n", indent, id.SerialNumber)
+	if issuer == nil || hash == 0 {
+		return
+	}
+	nameHash, keyHash, err := issuerHashes(issuer, hash)
+	if err != nil {
+		fmt.Fprintf(w, "%sIssuer check failed: %s\n", indent, err)
+		return
+	}
+	fmt.Fprintf(w, "%sMatchesIssuer name %t key %t\n", indent,
+		bytes.Equal(nameHash, id.IssuerNameHash), bytes.Equal(keyHash, id.IssuerKeyHash))
+}
+
+func printExtensions(w io.Writer, indent string, exts []pkix.Extension) {
+	for _, ext := range exts {
+		name := ext.Id.String()
+		if ext.Id.Equal(oidNonce) {
+			name = "nonce"
+		}
+		fmt.Fprintf(w, "%sExtension %s critical %t: %x\n", indent, name, ext.Critical, ext.Value)
+	}
+}
+
+type decodedSingleResponse struct {
+	CertID     certID
+	Status     asn1.RawValue
+	ThisUpdate time.Time        `asn1:"generalized"`
+	NextUpdate time.Time        `asn1:"generalized,explicit,tag:0,optional"`
+	Extensions []pkix.Extension `asn1:"explicit,tag:1,optional"`
+}
+
+type decodedResponseData struct {
+	Version     int `asn1:"optional,default:0,explicit,tag:0"`
+	ResponderID asn1.RawValue
+	ProducedAt  time.Time `asn1:"generalized"`
+	Responses   []decodedSingleResponse
+	Extensions  []pkix.Extension `asn1:"explicit,tag:1,optional"`
+}
+
+type revokedInfo struct {
+	RevocationTime time.Time       `asn1:"generalized"`
+	Reason         asn1.Enumerated `asn1:"explicit,tag:0,optional"`
+}
+
+type decodedResponse struct {
+	Status        asn1.Enumerated
+	ResponseBytes struct {
+		ResponseType asn1.ObjectIdentifier
+		Response     []byte
+	} `asn1:"explicit,tag:0,optional"`
+}
+
+type decodedBasicResponse struct {
+	TBSResponseData    asn1.RawValue
+	SignatureAlgorithm pkix.AlgorithmIdentifier
+	Signature          asn1.BitString
+	Certificates       []asn1.RawValue `asn1:"explicit,tag:0,optional"`
+}
+
+// oidBasicResponse is id-pkix-ocsp-basic, the only response type defined by
+// RFC 6960.
+var oidBasicResponse = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 48, 1, 1}
+
+// signatureAlgorithms names the signature algorithms OCSP responses use.
+var signatureAlgorithms = []struct {
+	oid  asn1.ObjectIdentifier
+	name string
+}{
+	{asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 5}, "SHA1-RSA"},
+	{asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 11}, "SHA256-RSA"},
+	{asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 12}, "SHA384-RSA"},
+	{asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 13}, "SHA512-RSA"},
+	{asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 10}, "RSASSA-PSS"},
+	{asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 1}, "ECDSA-SHA1"},
+	{asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 2}, "ECDSA-SHA256"},
+	{asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 3}, "ECDSA-SHA384"},
+	{asn1.ObjectIdentifier{1, 2, 840, 10045, 4, 3, 4}, "ECDSA-SHA512"},
+	{asn1.ObjectIdentifier{1, 3, 101, 112}, "Ed25519"},
+}
+
+func signatureAlgorithmName(oid asn1.ObjectIdentifier) string {
+	for _, alg := range signatureAlgorithms {
+		if oid.Equal(alg.oid) {
+			return alg.name
+		}
+	}
+	return oid.String()
+}
+
+// PrintResponse writes every field of the DER-encoded OCSP response der to
+// w, including every SingleResponse and embedded certificate. If issuer is
+// non-nil, the response's signature and CertIDs are checked against it.
+func PrintResponse(w io.Writer, der []byte, issuer *x509.Certificate) error {
+	var resp decodedResponse
+	if rest, err := asn1.Unmarshal(der, &resp); err != nil {
+		return fmt.Errorf("parsing OCSP response: %s", err)
+	} else if len(rest) > 0 {
+		return fmt.Errorf("parsing OCSP response: %d bytes of trailing data", len(rest))
+	}
+	if resp.Status != 0 {
+		fmt.Fprintf(w, "OCSP Response:\n  ResponseStatus %s\n", ocsp.ResponseStatus(resp.Status))
+		return nil
+	}
+	if !resp.ResponseBytes.ResponseType.Equal(oidBasicResponse) {
+		return fmt.Errorf("unsupported response type %s", resp.ResponseBytes.ResponseType)
+	}
+	var basic decodedBasicResponse
+	if _, err := asn1.Unmarshal(resp.ResponseBytes.Response, &basic); err != nil {
+		return fmt.Errorf("parsing BasicOCSPResponse: %s", err)
+	}
+	var data decodedResponseData
+	if _, err := asn1.Unmarshal(basic.TBSResponseData.FullBytes, &data); err != nil {
+		return fmt.Errorf("parsing tbsResponseData: %s", err)
+	}
+	fmt.Fprintf(w, "OCSP Response:\n")
+	fmt.Fprintf(w, "  ResponseStatus success\n")
+	fmt.Fprintf(w, "  Version %d\n", data.Version+1)
+	switch data.ResponderID.Tag {
+	case 1:
+		var name pkix.RDNSequence
+		if _, err := asn1.Unmarshal(data.ResponderID.Bytes, &name); err == nil {
+			var n pkix.Name
+			n.FillFromRDNSequence(&name)
+			fmt.Fprintf(w, "  ResponderID byName %s\n", n)
+		} else {
+			fmt.Fprintf(w, "  ResponderID byName (unparseable: %s) %x\n", err, data.ResponderID.Bytes)
+		}
+	case 2:
+		var keyHash []byte
+		if _, err := asn1.Unmarshal(data.ResponderID.Bytes, &keyHash); err == nil {
+			fmt.Fprintf(w, "  ResponderID byKey %x\n", keyHash)
+		} else {
+			fmt.Fprintf(w, "  ResponderID byKey (unparseable: %s) %x\n", err, data.ResponderID.Bytes)
+		}
+	default:
+		fmt.Fprintf(w, "  ResponderID unknown tag %d\n", data.ResponderID.Tag)
+	}
+	fmt.Fprintf(w, "  ProducedAt %s\n", data.ProducedAt)
+	for i, single := range data.Responses {
+		fmt.Fprintf(w, "  Response %d:\n", i)
+		printCertID(w, "    ", single.CertID, issuer)
+		switch single.Status.Tag {
+		case 0:
+			fmt.Fprintf(w, "    CertStatus good\n")
+		case 1:
+			var info revokedInfo
+			if _, err := asn1.UnmarshalWithParams(single.Status.FullBytes, &info, "tag:1"); err != nil {
+				fmt.Fprintf(w, "    CertStatus revoked (unparseable: %s)\n", err)
+			} else {
+				fmt.Fprintf(w, "    CertStatus revoked at %s reason %d\n", info.RevocationTime, info.Reason)
+			}
+		case 2:
+			fmt.Fprintf(w, "    CertStatus unknown\n")
+		default:
+			fmt.Fprintf(w, "    CertStatus invalid tag %d\n", single.Status.Tag)
+		}
+		fmt.Fprintf(w, "    ThisUpdate %s\n", single.ThisUpdate)
+		if single.NextUpdate.IsZero() {
+			fmt.Fprintf(w, "    NextUpdate absent\n")
+		} else {
+			fmt.Fprintf(w, "    NextUpdate %s (validity %s)\n",
+				single.NextUpdate, single.NextUpdate.Sub(single.ThisUpdate))
+		}
+		printExtensions(w, "    ", single.Extensions)
+	}
+	printExtensions(w, "  ", data.Extensions)
+	fmt.Fprintf(w, "  SignatureAlgorithm %s\n", signatureAlgorithmName(basic.SignatureAlgorithm.Algorithm))
+	fmt.Fprintf(w, "  Signature %x\n", basic.Signature.RightAlign())
+	for i, raw := range basic.Certificates {
+		fmt.Fprintf(w, "  Certificate %d:\n", i)
+		c, err := x509.ParseCertificate(raw.FullBytes)
+		if err != nil {
+			fmt.Fprintf(w, "    (unparseable: %s)\n", err)
+			continue
+		}
+		fmt.Fprintf(w, "    Subject %s\n", c.Subject)
+		fmt.Fprintf(w, "    Issuer %s\n", c.Issuer)
+		fmt.Fprintf(w, "    SerialNumber %x\n", c.SerialNumber)
+		fmt.Fprintf(w, "    NotBefore %s NotAfter %s\n", c.NotBefore, c.NotAfter)
+		fmt.Fprintf(w, "    PEM\n%s", pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: c.Raw}))
+	}
+	if issuer != nil && len(data.Responses) > 0 {
+		// ParseResponseForCert, unlike ParseResponse, accepts responses
+		// with several SingleResponses; any of their serials will do.
+		cert := &x509.Certificate{SerialNumber: data.Responses[0].CertID.SerialNumber}
+		if _, err := ocsp.ParseResponseForCert(der, cert, issuer); err != nil {
+			fmt.Fprintf(w, "  Signature invalid: %s\n", err)
+		} else {
+			fmt.Fprintf(w, "  Signature valid for issuer %s\n", issuer.Subject)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package helper
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/pem"
+	"math/big"
+	"strings"
+	"testing"
+
+	"github.com/jsha/go/ocsp/responder"
+)
+
+func TestDecodeInput(t *testing.T) {
+	ca, err := responder.NewCA("Test CA")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The serial is chosen so that the base64 of the request has both "+"
+	// and "/", which the URL-safe alphabet and URL encoding replace.
+	var der []byte
+	for i := int64(1); ; i++ {
+		der, err = CreateRequest(big.NewInt(i), ca.Cert, 0, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if b64 := base64.StdEncoding.EncodeToString(der); strings.Contains(b64, "+") && strings.Contains(b64, "/") {
+			break
+		}
+	}
+	std := base64.StdEncoding.EncodeToString(der)
+	testCases := []struct {
+		name    string
+		input   string
+		wantErr bool
+	}{
+		{"DER", string(der), false},
+		{"PEM", string(pem.EncodeToMemory(&pem.Block{Type: "OCSP REQUEST", Bytes: der})), false},
+		{"base64", std, false},
+		{"base64 with newline", std + "\n", false},
+		{"base64 wrapped", std[:20] + "\n" + std[20:], false},
+		{"raw base64", base64.RawStdEncoding.EncodeToString(der), false},
+		{"base64url", base64.URLEncoding.EncodeToString(der), false},
+		{"raw base64url", base64.RawURLEncoding.EncodeToString(der), false},
+		{"GET URL", GetURL("http://ocsp.example.com/", der), false},
+		{"GET URL with path", GetURL("http://ocsp.example.com/a/b", der), false},
+		{"not base64", "not an OCSP request!", true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := DecodeInput([]byte(tc.input))
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("got error %v, want error %t", err, tc.wantErr)
+			}
+			if tc.wantErr {
+				return
+			}
+			if !bytes.Equal(got, der) {
+				t.Errorf("got %x, want %x", got, der)
+			}
+			if !IsRequest(got) {
+				t.Errorf("IsRequest is false for a request")
+			}
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package helper
+
+import (
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+// Error classes recorded in Result.ErrorClass when a check fails. They are
+// coarse enough to be used as metric labels.
+const (
+	ClassInput     = "input"
+	ClassExpired   = "expired"
+	ClassIssuer    = "issuer"
+	ClassRequest   = "request"
+	ClassNetwork   = "network"
+	ClassHTTP      = "http-status"
+	ClassResponder = "responder-status"
+	ClassParse     = "parse"
+	ClassSignature = "signature"
+)
+
+// ClassOK is what Result.Class returns for a check with no errors.
+const ClassOK = "ok"
+
+// fail records class as the reason result failed and returns an error
+// formatted from format and args.
+func (r *Result) fail(class, format string, args ...interface{}) error {
+	r.ErrorClass = class
+	return fmt.Errorf(format, args...)
+}
+
+// parseErrorClass returns the class of an error from ocsp.ParseResponse.
+func parseErrorClass(err error) string {
+	if _, ok := err.(ocsp.ResponseError); ok {
+		return ClassResponder
+	}
+	if strings.Contains(err.Error(), "signature") {
+		return ClassSignature
+	}
+	return ClassParse
+}
+
+// retryable reports whether a failure of the given class and HTTP status
+// might succeed if tried again. parseErr is the error from parsing the
+// response, if that is how the request failed.
+func retryable(class string, httpStatus int, parseErr error) bool {
+	switch class {
+	case ClassNetwork:
+		return true
+	case ClassHTTP:
+		return httpStatus >= 500
+	case ClassResponder:
+		// tryLater is the only OCSP error status worth retrying.
+		respErr, ok := parseErr.(ocsp.ResponseError)
+		return ok && respErr.Status == ocsp.TryLater
+	}
+	return false
+}
+
+// Class summarizes the outcome of a check in a single word: ErrorClass if
+// the check failed, otherwise the ID of the first error-severity violation,
+// otherwise ClassOK.
+func (r *Result) Class() string {
+	if r.ErrorClass != "" {
+		return r.ErrorClass
+	}
+	for _, v := range r.Violations {
+		if v.Severity >= SeverityError {
+			return v.ID
+		}
+	}
+	return ClassOK
+}
@@ -0,0 +1,63 @@
+package helper
+
+import (
+	"crypto/x509"
+	"flag"
+	"time"
+)
+
+// RegisterFlags registers the flags shared by the OCSP commands on fs. The
+// returned function builds Options from their values and must be called
+// after fs has been parsed.
+func RegisterFlags(fs *flag.FlagSet) func() (Options, error) {
+	method := fs.String("method", "GET", "Method to use for fetching OCSP")
+	urlOverride := fs.String("url", "", "URL of OCSP responder to override")
+	timeout := fs.Duration("timeout", 5*time.Second, "Timeout for each HTTP request")
+	tooSoon := fs.Int("too-soon", 76, "If NextUpdate is fewer than this many hours in future, warn.")
+	ignoreExpiredCerts := fs.Bool("ignore-expired-certs", false, "If a cert is expired, don't bother requesting OCSP.")
+	expectStatus := fs.Int("expect-status", 0, "Expect response to have this numeric status (0=good, 1=revoked)")
+	issuerFile := fs.String("issuer", "", "File containing the issuer, or a bundle of candidate issuers, instead of fetching via AIA")
+	issuerCache := fs.String("issuer-cache", "", "Directory in which to cache issuers fetched via AIA")
+	mustStaple := fs.Bool("must-staple", false, "Report whether certificates are Must-Staple, and with -connect require a valid stapled response for them")
+	allResponders := fs.Bool("all-responders", false, "Query every OCSP URL in the certificate and compare their answers")
+	bothMethods := fs.Bool("both-methods", false, "Query each responder with both GET and POST and compare their answers")
+	hash := fs.String("hash", "sha1", "Hash to use for the request's CertID (sha1 or sha256)")
+	nonce := fs.Bool("nonce", false, "Include a nonce in requests and check that responses echo it")
+	responderExpiry := fs.Duration("responder-expiry-warning", 30*24*time.Hour, "Warn when a delegated responder certificate expires within this long")
+	retries := fs.Int("retries", 0, "Number of times to retry requests that fail with network errors or HTTP 5xx")
+	retryBackoff := fs.Duration("retry-backoff", time.Second, "Delay before the first retry, doubling for each further retry")
+	lint := fs.Bool("lint", false, "Check responses against RFC 6960, RFC 5019 and the Baseline Requirements")
+	return func() (Options, error) {
+		var issuers []*x509.Certificate
+		if *issuerFile != "" {
+			var err error
+			issuers, err = ReadCertificates(*issuerFile)
+			if err != nil {
+				return Options{}, err
+			}
+		}
+		hashAlg, err := ParseHash(*hash)
+		if err != nil {
+			return Options{}, err
+		}
+		return Options{
+			Method:                 *method,
+			URLOverride:            *urlOverride,
+			Timeout:                *timeout,
+			TooSoon:                time.Duration(*tooSoon) * time.Hour,
+			IgnoreExpiredCerts:     *ignoreExpiredCerts,
+			ExpectStatus:           *expectStatus,
+			Issuers:                issuers,
+			IssuerCacheDir:         *issuerCache,
+			EnforceMustStaple:      *mustStaple,
+			AllResponders:          *allResponders,
+			BothMethods:            *bothMethods,
+			Hash:                   hashAlg,
+			Nonce:                  *nonce,
+			Lint:                   *lint,
+			Retries:                *retries,
+			RetryBackoff:           *retryBackoff,
+			ResponderExpiryWarning: *responderExpiry,
+		}, nil
+	}
+}
@@ -1,187 +1,560 @@
+// Package helper fetches OCSP responses for certificates and checks them
+// against a configurable policy. It is used by the ocsp and ocsp_forever
+// commands, but is also suitable for embedding in other programs.
 package helper
 
 import (
 	"bytes"
+	"crypto"
+	"crypto/rand"
 	"crypto/x509"
-	"encoding/asn1"
-	"encoding/base64"
-	"encoding/pem"
-	"flag"
 	"fmt"
-	"io/ioutil"
+	"math/big"
 	"net/http"
 	"net/url"
 	"strings"
+	"sync"
 	"time"
 
 	"golang.org/x/crypto/ocsp"
 )
 
-var method = flag.String("method", "GET", "Method to use for fetching OCSP")
-var urlOverride = flag.String("url", "", "URL of OCSP responder to override")
-var tooSoon = flag.Int("too-soon", 76, "If NextUpdate is fewer than this many hours in future, warn.")
-var ignoreExpiredCerts = flag.Bool("ignore-expired-certs", false, "If a cert is expired, don't bother requesting OCSP.")
-var expectStatus = flag.Int("expect-status", 0, "Expect response to have this numeric status (0=good, 1=revoked)")
+// Options controls how a Checker fetches and validates OCSP responses. The
+// zero value is usable: it fetches with GET, times out after five seconds and
+// expects a status of Good.
+type Options struct {
+	// Method is the HTTP method used to fetch OCSP, "GET" or "POST".
+	Method string
+	// URLOverride, if non-empty, is used instead of the responder URL listed
+	// in the certificate.
+	URLOverride string
+	// Timeout bounds each HTTP request made by the Checker.
+	Timeout time.Duration
+	// HTTPClient is used for all requests. If nil, a default client is used.
+	HTTPClient *http.Client
+	// TooSoon is the minimum acceptable time between now and NextUpdate.
+	// Zero disables the check.
+	TooSoon time.Duration
+	// IgnoreExpiredCerts skips expired certificates instead of treating them
+	// as an error.
+	IgnoreExpiredCerts bool
+	// ExpectStatus is the CertStatus the response must have (ocsp.Good,
+	// ocsp.Revoked, ...).
+	ExpectStatus int
+	// Issuers are candidate issuer certificates to use instead of fetching
+	// the issuer via AIA. The one matching a leaf's Authority Key Identifier
+	// is used.
+	Issuers []*x509.Certificate
+	// IssuerCacheDir, if non-empty, is a directory in which issuers fetched
+	// via AIA are cached across runs, keyed by URL. Cached issuers are
+	// fetched again once they are a week old or one of them has expired.
+	IssuerCacheDir string
+	// AllResponders queries every OCSP URL listed in the certificate rather
+	// than only the first, and reports any disagreement between them.
+	AllResponders bool
+	// BothMethods queries each responder with both GET and POST.
+	BothMethods bool
+	// Hash is used to compute the request's CertID. Defaults to SHA-1.
+	Hash crypto.Hash
+	// Nonce includes a random nonce extension in each request, and checks
+	// that any nonce in the response matches it.
+	Nonce bool
+	// Retries is how many times to retry a request that failed in a way
+	// that might be transient, such as a network error or HTTP 5xx.
+	Retries int
+	// RetryBackoff is the delay before the first retry. It doubles with
+	// each further retry.
+	RetryBackoff time.Duration
+	// Lint runs the Lints suite against each response.
+	Lint bool
+	// ResponderExpiryWarning is how long before a delegated responder
+	// certificate expires to start warning about it.
+	ResponderExpiryWarning time.Duration
+	// EnforceMustStaple makes CheckTLS require that a server presenting a
+	// Must-Staple certificate staple a valid, unexpired response for it.
+	EnforceMustStaple bool
+	// DryRun builds each request and fills in the Result's Server, Method
+	// and URL without sending it, with an alternate Result for each further
+	// responder if AllResponders is set. The issuer may still be fetched via
+	// AIA.
+	DryRun bool
+}
+
+// Checker fetches OCSP responses according to its Options. It is safe for
+// concurrent use.
+type Checker struct {
+	opts   Options
+	client *http.Client
+
+	mu      sync.Mutex
+	issuers map[string]cachedIssuers
+	// fetching holds the AIA fetches in progress, by URL, so that
+	// concurrent checks of certificates from the same issuer wait for one
+	// fetch instead of each making their own.
+	fetching map[string]*issuerFetch
+}
 
-func getIssuer(cert *x509.Certificate) (*x509.Certificate, error) {
-	if len(cert.IssuingCertificateURL) == 0 {
-		return nil, fmt.Errorf("No AIA information available, can't get issuer")
+// New returns a Checker that uses opts.
+func New(opts Options) *Checker {
+	if opts.Method == "" {
+		opts.Method = "GET"
 	}
-	issuerURL := cert.IssuingCertificateURL[0]
-	resp, err := http.Get(issuerURL)
-	if err != nil {
-		return nil, err
+	if opts.Timeout == 0 {
+		opts.Timeout = 5 * time.Second
 	}
-	defer resp.Body.Close()
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
+	client := opts.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &Checker{
+		opts:     opts,
+		client:   client,
+		issuers:  make(map[string]cachedIssuers),
+		fetching: make(map[string]*issuerFetch),
+	}
+}
+
+// Violation describes a way in which an otherwise well-formed OCSP response
+// failed to meet the Checker's policy.
+type Violation struct {
+	// ID is a short, stable identifier for the kind of violation, suitable
+	// for use as a metric label.
+	ID       string
+	Severity Severity
+	Message  string
+}
+
+func (v Violation) String() string {
+	return fmt.Sprintf("%s: %s", v.ID, v.Message)
+}
+
+// Result holds everything learned while checking a single certificate. A
+// Result may be partially filled in when checking returned an error.
+type Result struct {
+	// Cert is nil for checks made with CheckSerial; Serial is always set.
+	Cert   *x509.Certificate
+	Serial *big.Int
+	Issuer *x509.Certificate
+
+	// Skipped is true if the certificate was expired and IgnoreExpiredCerts
+	// was set. No request was made.
+	Skipped bool
+	// DryRun is true if the request was built but, because of
+	// Options.DryRun, not sent.
+	DryRun bool
+
+	// Server is the responder URL queried. Method and URL describe the
+	// OCSP request as actually sent; a GET request too long for RFC 5019 is
+	// sent as a POST instead.
+	Server     string
+	Method     string
+	URL        string
+	RawRequest []byte
+	// Nonce is the nonce sent in the request, if any, and NonceEchoed is
+	// true if the response included it.
+	Nonce       []byte
+	NonceEchoed bool
+
+	// Attempts is how many times the request was sent, including retries.
+	Attempts    int
+	HTTPStatus  int
+	Header      http.Header
+	RawResponse []byte
+	Response    *ocsp.Response
+
+	// Start is when the check began. IssuerDuration is the time spent
+	// obtaining the issuer, FetchDuration the time spent on the OCSP
+	// HTTP request, and Duration the time for the whole check.
+	Start          time.Time
+	IssuerDuration time.Duration
+	FetchDuration  time.Duration
+	Duration       time.Duration
+	// IssuerTiming breaks down the AIA request for the issuer; it is nil
+	// if the issuer was found without one. FetchTiming breaks down the
+	// last OCSP request.
+	IssuerTiming *Timing
+	FetchTiming  Timing
+
+	// Addr is the server address for checks made with CheckTLS. RawStapled
+	// and StapledResponse are the OCSP response the server stapled, if any.
+	Addr            string
+	RawStapled      []byte
+	StapledResponse *ocsp.Response
+
+	// Delegated describes the delegated responder certificate, if the
+	// response was signed by one.
+	Delegated *DelegatedResponder
+
+	// MustStaple is true if Cert has the TLS Feature extension with
+	// status_request.
+	MustStaple bool
+
+	Violations []Violation
+	// ErrorClass is set to one of the Class constants when the check
+	// returns an error.
+	ErrorClass string
+
+	// Alternates holds the results of querying additional responders or
+	// methods when AllResponders or BothMethods is set.
+	Alternates []*Result
+}
+
+// Err returns an error summarizing the violations in r with SeverityError,
+// or nil if there were none.
+func (r *Result) Err() error {
+	var msgs []string
+	for _, v := range r.Violations {
+		if v.Severity >= SeverityError {
+			msgs = append(msgs, v.String())
+		}
 	}
-	var issuer *x509.Certificate
-	if strings.Join(resp.Header["Content-Type"], "") == "application/x-pkcs7-mime" {
-		issuer, err = parseCMS(body)
-	} else {
-		issuer, err = parse(body)
+	if len(msgs) == 0 {
+		return nil
 	}
+	return fmt.Errorf("%s", strings.Join(msgs, "; "))
+}
+
+func (r *Result) addViolation(id, format string, args ...interface{}) {
+	r.Violations = append(r.Violations, Violation{
+		ID:       id,
+		Severity: SeverityError,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+// Req reads a certificate from fileName and checks its OCSP status. If the
+// file contains a chain, the first certificate is checked and the rest are
+// considered as its issuer.
+func (c *Checker) Req(fileName string) (*Result, error) {
+	certs, err := ReadCertificates(fileName)
 	if err != nil {
-		return nil, fmt.Errorf("from %s: %s", issuerURL, err)
+		return nil, fmt.Errorf("parsing certificate: %s", err)
 	}
-	return issuer, nil
+	return c.CheckChain(certs)
+}
+
+// Check finds cert's issuer and checks cert's OCSP status.
+func (c *Checker) Check(cert *x509.Certificate) (*Result, error) {
+	return c.CheckChain([]*x509.Certificate{cert})
 }
 
-func parse(body []byte) (*x509.Certificate, error) {
-	block, _ := pem.Decode(body)
-	var der []byte
-	if block == nil {
-		der = body
-	} else {
-		der = block.Bytes
+// CheckChain checks the OCSP status of chain[0]. Its issuer is looked for in
+// the rest of chain, then in Options.Issuers, and finally fetched via AIA.
+func (c *Checker) CheckChain(chain []*x509.Certificate) (*Result, error) {
+	if len(chain) == 0 {
+		return nil, fmt.Errorf("no certificates")
 	}
-	cert, err := x509.ParseCertificate(der)
+	cert := chain[0]
+	result := newResult(cert)
+	defer func() { result.Duration = time.Since(result.Start) }()
+	if skip, err := c.checkExpired(result); skip || err != nil {
+		return result, err
+	}
+	issuer, err := c.issuerFor(result, chain[1:])
+	result.IssuerDuration = time.Since(result.Start)
 	if err != nil {
-		return nil, err
+		return result, result.fail(ClassIssuer, "getting issuer: %s", err)
+	}
+	return result, c.check(result, issuer)
+}
+
+// CheckWithIssuer checks cert's OCSP status using the provided issuer.
+func (c *Checker) CheckWithIssuer(cert, issuer *x509.Certificate) (*Result, error) {
+	result := newResult(cert)
+	defer func() { result.Duration = time.Since(result.Start) }()
+	if skip, err := c.checkExpired(result); skip || err != nil {
+		return result, err
 	}
-	return cert, nil
+	return result, c.check(result, issuer)
 }
 
-// parseCMS parses certificates from CMS messages of type SignedData.
-func parseCMS(body []byte) (*x509.Certificate, error) {
-	type signedData struct {
-		Version          int
-		Digests          asn1.RawValue
-		EncapContentInfo asn1.RawValue
-		Certificates     asn1.RawValue
+// CheckSerial checks the OCSP status of the certificate with the given
+// serial number issued by issuer, without needing the certificate itself.
+// Since there is no certificate to take a responder URL from, the request is
+// sent to Options.URLOverride, and expiry is not checked.
+func (c *Checker) CheckSerial(serial *big.Int, issuer *x509.Certificate) (*Result, error) {
+	if c.opts.URLOverride == "" {
+		return nil, fmt.Errorf("checking by serial requires a responder URL")
 	}
-	type cms struct {
-		ContentType asn1.ObjectIdentifier
-		SignedData  signedData `asn1:"explicit,tag:0"`
+	result := &Result{
+		Serial: serial,
+		Start:  time.Now(),
 	}
-	var msg cms
-	_, err := asn1.Unmarshal(body, &msg)
-	cert, err := x509.ParseCertificate(msg.SignedData.Certificates.Bytes)
-	if err != nil {
-		return nil, fmt.Errorf("parsing CMS: %s", err)
+	defer func() { result.Duration = time.Since(result.Start) }()
+	return result, c.check(result, issuer)
+}
+
+func newResult(cert *x509.Certificate) *Result {
+	result := &Result{
+		Cert:   cert,
+		Serial: cert.SerialNumber,
+		Start:  time.Now(),
 	}
-	return cert, nil
+	detectMustStaple(result)
+	return result
 }
 
-func Req(fileName string) (*ocsp.Response, error) {
-	tooSoonDuration := time.Duration(*tooSoon) * time.Hour
-	contents, err := ioutil.ReadFile(fileName)
-	if err != nil {
-		return nil, err
+func (c *Checker) checkExpired(result *Result) (bool, error) {
+	cert := result.Cert
+	if time.Now().After(cert.NotAfter) {
+		if c.opts.IgnoreExpiredCerts {
+			result.Skipped = true
+			return true, nil
+		}
+		return false, result.fail(ClassExpired, "certificate expired %s ago: %s",
+			time.Now().Sub(cert.NotAfter), cert.NotAfter)
+	}
+	return false, nil
+}
+
+func (c *Checker) check(result *Result, issuer *x509.Certificate) error {
+	result.Issuer = issuer
+	if c.opts.Nonce {
+		result.Nonce = make([]byte, 16)
+		if _, err := rand.Read(result.Nonce); err != nil {
+			return result.fail(ClassRequest, "generating nonce: %s", err)
+		}
 	}
-	cert, err := parse(contents)
+	req, err := CreateRequest(result.Serial, issuer, c.opts.Hash, result.Nonce)
 	if err != nil {
-		return nil, fmt.Errorf("parsing certificate: %s", err)
+		return result.fail(ClassRequest, "creating OCSP request: %s", err)
 	}
-	if time.Now().After(cert.NotAfter) {
-		if *ignoreExpiredCerts {
-			return nil, nil
+	result.RawRequest = req
+	var servers []string
+	if result.Cert != nil {
+		servers = result.Cert.OCSPServer
+	}
+	if c.opts.URLOverride != "" {
+		servers = []string{c.opts.URLOverride}
+	}
+	if len(servers) == 0 {
+		return result.fail(ClassRequest, "no ocsp servers in cert")
+	}
+	if !c.opts.AllResponders {
+		servers = servers[:1]
+	}
+	methods := []string{c.opts.Method}
+	if c.opts.BothMethods {
+		if c.opts.Method == "GET" {
+			methods = append(methods, "POST")
 		} else {
-			return nil, fmt.Errorf("certificate expired %s ago: %s",
-				time.Now().Sub(cert.NotAfter), cert.NotAfter)
+			methods = append(methods, "GET")
 		}
 	}
-	issuer, err := getIssuer(cert)
-	if err != nil {
-		return nil, fmt.Errorf("getting issuer: %s", err)
+
+	if c.opts.DryRun {
+		result.DryRun = true
+		for _, server := range servers[1:] {
+			alt := &Result{
+				Cert:       result.Cert,
+				Serial:     result.Serial,
+				Issuer:     issuer,
+				RawRequest: req,
+				Nonce:      result.Nonce,
+				DryRun:     true,
+			}
+			if err := c.prepare(alt, server, methods[0]); err != nil {
+				return result.fail(alt.ErrorClass, "%s: %s", server, err)
+			}
+			result.Alternates = append(result.Alternates, alt)
+		}
+		return c.prepare(result, servers[0], methods[0])
 	}
-	req, err := ocsp.CreateRequest(cert, issuer, nil)
-	if err != nil {
-		return nil, fmt.Errorf("creating OCSP request: %s", err)
+
+	// The first responder and method fill in result itself; any others are
+	// recorded as alternates and compared against it.
+	err = c.fetch(result, servers[0], methods[0])
+	for i, server := range servers {
+		// prepare sends a GET that is too long as a POST, so comparing
+		// the two would only send the same POST twice.
+		serverMethods := methods
+		if n := len(GetURL(server, req)); len(methods) > 1 && n > maxGetURLLength {
+			serverMethods = []string{"POST"}
+			result.Violations = append(result.Violations, Violation{
+				ID:       "get-skipped",
+				Severity: SeverityNotice,
+				Message: fmt.Sprintf("%s: GET not compared, its URL is %d bytes, more than the %d RFC 5019 allows",
+					server, n, maxGetURLLength),
+			})
+		}
+		for j, method := range serverMethods {
+			if i == 0 && j == 0 {
+				continue
+			}
+			alt := &Result{
+				Cert:       result.Cert,
+				Serial:     result.Serial,
+				Issuer:     issuer,
+				RawRequest: req,
+				Nonce:      result.Nonce,
+				Start:      time.Now(),
+			}
+			altErr := c.fetch(alt, server, method)
+			alt.Duration = time.Since(alt.Start)
+			result.Alternates = append(result.Alternates, alt)
+			if altErr != nil {
+				result.addViolation("responder-error", "%s %s: %s", method, server, altErr)
+				continue
+			}
+			for _, v := range alt.Violations {
+				v.Message = fmt.Sprintf("%s %s: %s", method, server, v.Message)
+				result.Violations = append(result.Violations, v)
+			}
+			if result.Response == nil {
+				continue
+			}
+			for _, diff := range compareResponses(result.Response, alt.Response) {
+				result.addViolation("responder-disagreement", "%s %s vs %s %s: %s",
+					result.Method, servers[0], method, server, diff)
+			}
+		}
 	}
-	if len(cert.OCSPServer) == 0 {
-		return nil, fmt.Errorf("no ocsp servers in cert")
+	if c.opts.Lint {
+		lintETags(result)
 	}
-	encodedReq := base64.StdEncoding.EncodeToString(req)
-	var httpResp *http.Response
-	ocspServer := cert.OCSPServer[0]
-	ocspURL, err := url.Parse(ocspServer)
-	if *urlOverride != "" {
-		ocspServer = *urlOverride
+	return err
+}
+
+// compareResponses returns a description of each way in which the
+// responses a and b disagree about the certificate's status.
+func compareResponses(a, b *ocsp.Response) []string {
+	var diffs []string
+	if a.Status != b.Status {
+		diffs = append(diffs, fmt.Sprintf("CertStatus %d vs %d", a.Status, b.Status))
 	}
-	if err != nil {
-		return nil, fmt.Errorf("parsing URL: %s", err)
-	}
-	http.DefaultClient.Timeout = 5 * time.Second
-	if *method == "GET" {
-		ocspURL.Path = encodedReq
-		fmt.Printf("Fetching %s\n", ocspURL.String())
-		var err error
-		httpResp, err = http.Get(ocspURL.String())
-		if err != nil {
-			return nil, fmt.Errorf("fetching: %s", err)
+	if !a.ThisUpdate.Equal(b.ThisUpdate) {
+		diffs = append(diffs, fmt.Sprintf("ThisUpdate %s vs %s", a.ThisUpdate, b.ThisUpdate))
+	}
+	if !a.NextUpdate.Equal(b.NextUpdate) {
+		diffs = append(diffs, fmt.Sprintf("NextUpdate %s vs %s", a.NextUpdate, b.NextUpdate))
+	}
+	if !a.RevokedAt.Equal(b.RevokedAt) {
+		diffs = append(diffs, fmt.Sprintf("RevokedAt %s vs %s", a.RevokedAt, b.RevokedAt))
+	}
+	if signerA, signerB := signer(a), signer(b); signerA != signerB {
+		diffs = append(diffs, fmt.Sprintf("signer %s vs %s", signerA, signerB))
+	}
+	return diffs
+}
+
+// signer describes the certificate that signed resp: either the issuer
+// itself or a delegated responder certificate.
+func signer(resp *ocsp.Response) string {
+	if resp.Certificate == nil {
+		return "issuer"
+	}
+	return fmt.Sprintf("%q (serial %x)", resp.Certificate.Subject, resp.Certificate.SerialNumber)
+}
+
+// fetch requests result.RawRequest from server using method, retrying
+// transient failures, then parses and evaluates the response, filling in
+// result.
+func (c *Checker) fetch(result *Result, server, method string) error {
+	if err := c.prepare(result, server, method); err != nil {
+		return err
+	}
+	// ParseResponseForCert only uses the certificate to select the response
+	// with a matching serial, so a stand-in suffices when checking by serial.
+	cert := result.Cert
+	if cert == nil {
+		cert = &x509.Certificate{SerialNumber: result.Serial}
+	}
+	var resp *ocsp.Response
+	var err error
+	for attempt := 0; ; attempt++ {
+		result.Attempts = attempt + 1
+		result.ErrorClass = ""
+		var respBytes []byte
+		var parseErr error
+		respBytes, err = c.fetchOnce(result)
+		if err == nil {
+			resp, parseErr = ocsp.ParseResponseForCert(respBytes, cert, result.Issuer)
+			if parseErr != nil {
+				err = result.fail(parseErrorClass(parseErr), "parsing response: %s", parseErr)
+			}
 		}
-	} else if *method == "POST" {
-		fmt.Printf("POSTing request, reproduce with: curl -i --data-binary @- %s < <(base64 -d <<<%s)\n",
-			ocspServer, encodedReq)
-		var err error
-		httpResp, err = http.Post(ocspServer, "application/ocsp-request", bytes.NewBuffer(req))
-		if err != nil {
-			return nil, fmt.Errorf("fetching: %s", err)
+		if err == nil || attempt >= c.opts.Retries || !retryable(result.ErrorClass, result.HTTPStatus, parseErr) {
+			break
 		}
-	} else {
-		return nil, fmt.Errorf("invalid method %s, expected GET or POST", *method)
+		time.Sleep(c.opts.RetryBackoff << uint(attempt))
+	}
+	if err != nil {
+		return err
+	}
+	result.Response = resp
+	checkNonce(result)
+	checkResponder(result, c.opts.ResponderExpiryWarning)
+	if c.opts.Lint {
+		lint(result)
+	}
+
+	if resp.Status != c.opts.ExpectStatus {
+		result.addViolation("wrong-status", "wrong CertStatus %d, expected %d",
+			resp.Status, c.opts.ExpectStatus)
+	}
+	timeTilExpiry := resp.NextUpdate.Sub(time.Now())
+	if c.opts.TooSoon > 0 && timeTilExpiry < c.opts.TooSoon {
+		result.addViolation("too-soon", "NextUpdate is too soon: %s", timeTilExpiry)
+	}
+	return nil
+}
+
+// prepare fills in result's Server, Method and URL for sending
+// result.RawRequest to server using method.
+func (c *Checker) prepare(result *Result, server, method string) error {
+	if _, err := url.Parse(server); err != nil {
+		return result.fail(ClassRequest, "parsing URL: %s", err)
 	}
-	fmt.Printf("HTTP %d\n", httpResp.StatusCode)
-	for k, v := range httpResp.Header {
-		for _, vv := range v {
-			fmt.Printf("%s: %s\n", k, vv)
+	getURL := GetURL(server, result.RawRequest)
+	if method == "GET" && len(getURL) > maxGetURLLength {
+		method = "POST"
+	}
+	result.Server = server
+	result.Method = method
+	result.URL = getURL
+	if method != "GET" {
+		result.URL = server
+	}
+	return nil
+}
+
+// fetchOnce makes a single HTTP request for result.RawRequest, as described
+// by result.Method and result.URL, and returns the response body.
+func (c *Checker) fetchOnce(result *Result) ([]byte, error) {
+	result.HTTPStatus, result.Header, result.RawResponse = 0, nil, nil
+	var httpReq *http.Request
+	var err error
+	switch result.Method {
+	case "GET":
+		httpReq, err = http.NewRequest("GET", result.URL, nil)
+	case "POST":
+		httpReq, err = http.NewRequest("POST", result.URL, bytes.NewReader(result.RawRequest))
+		if err == nil {
+			httpReq.Header.Set("Content-Type", "application/ocsp-request")
 		}
+	default:
+		return nil, result.fail(ClassRequest, "invalid method %s, expected GET or POST", result.Method)
+	}
+	if err != nil {
+		return nil, result.fail(ClassRequest, "building request: %s", err)
 	}
+
+	httpResp, respBytes, err := c.roundTrip(httpReq, &result.FetchTiming)
+	result.FetchDuration = result.FetchTiming.Total
+	if httpResp == nil {
+		return nil, result.fail(ClassNetwork, "fetching: %s", err)
+	}
+	result.HTTPStatus = httpResp.StatusCode
+	result.Header = httpResp.Header
+	result.RawResponse = respBytes
 	if httpResp.StatusCode != 200 {
-		return nil, fmt.Errorf("http status code %d", httpResp.StatusCode)
+		return nil, result.fail(ClassHTTP, "http status code %d", httpResp.StatusCode)
 	}
-	respBytes, err := ioutil.ReadAll(httpResp.Body)
 	if err != nil {
-		return nil, err
+		return nil, result.fail(ClassNetwork, "reading body: %s", err)
 	}
 	if len(respBytes) == 0 {
-		return nil, fmt.Errorf("empty reponse body")
-	}
-	fmt.Printf("\nDecoding body: %s\n", base64.StdEncoding.EncodeToString(respBytes))
-	resp, err := ocsp.ParseResponseForCert(respBytes, cert, issuer)
-	if err != nil {
-		return nil, fmt.Errorf("parsing response: %s", err)
-	}
-	if resp.Status != *expectStatus {
-		return nil, fmt.Errorf("wrong CertStatus %d, expected %d", resp.Status, *expectStatus)
-	}
-	fmt.Printf("\n")
-	fmt.Printf("Good response:\n")
-	fmt.Printf("  CertStatus %d\n", resp.Status)
-	fmt.Printf("  SerialNumber %036x\n", resp.SerialNumber)
-	fmt.Printf("  ProducedAt %s\n", resp.ProducedAt)
-	fmt.Printf("  ThisUpdate %s\n", resp.ThisUpdate)
-	fmt.Printf("  NextUpdate %s\n", resp.NextUpdate)
-	fmt.Printf("  RevokedAt %s\n", resp.RevokedAt)
-	fmt.Printf("  RevocationReason %d\n", resp.RevocationReason)
-	fmt.Printf("  SignatureAlgorithm %s\n", resp.SignatureAlgorithm)
-	fmt.Printf("  Extensions %#v\n", resp.Extensions)
-	timeTilExpiry := resp.NextUpdate.Sub(time.Now())
-	if timeTilExpiry < tooSoonDuration {
-		return nil, fmt.Errorf("NextUpdate is too soon: %s", timeTilExpiry)
+		return nil, result.fail(ClassParse, "empty reponse body")
 	}
-	return resp, nil
+	return respBytes, nil
 }
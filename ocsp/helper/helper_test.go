@@ -0,0 +1,234 @@
+package helper
+
+import (
+	"crypto/x509"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jsha/go/ocsp/responder"
+	"golang.org/x/crypto/ocsp"
+)
+
+// testEnv is a responder.Responder for a new CA, served over HTTP, and a
+// leaf certificate whose OCSP and AIA URLs point at it.
+type testEnv struct {
+	ca   *responder.CA
+	resp *responder.Responder
+	srv  *httptest.Server
+	leaf *x509.Certificate
+}
+
+// newTestEnv starts a responder. wrap, if non-nil, is given the responder
+// and returns the handler to serve instead.
+func newTestEnv(t *testing.T, wrap func(http.Handler) http.Handler) *testEnv {
+	t.Helper()
+	ca, err := responder.NewCA("Test CA")
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := &testEnv{
+		ca: ca,
+		resp: &responder.Responder{
+			Issuer:     ca.Cert,
+			Signer:     ca.Key,
+			SignerCert: ca.Cert,
+			AIAPath:    "/issuer",
+			Faults:     make(map[responder.Fault]bool),
+		},
+	}
+	var handler http.Handler = e.resp
+	if wrap != nil {
+		handler = wrap(e.resp)
+	}
+	e.srv = httptest.NewServer(handler)
+	t.Cleanup(e.srv.Close)
+	e.leaf, err = ca.Issue(big.NewInt(1), "example.com", e.srv.URL+"/ocsp", e.srv.URL+"/issuer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+// hasClass reports whether result failed with class, or has a violation
+// with it as its ID.
+func hasClass(result *Result, class string) bool {
+	if result.ErrorClass == class {
+		return true
+	}
+	for _, v := range result.Violations {
+		if v.ID == class {
+			return true
+		}
+	}
+	return false
+}
+
+func TestCheckStatus(t *testing.T) {
+	e := newTestEnv(t, nil)
+	e.resp.DefaultStatus = ocsp.Revoked
+	result, err := New(Options{}).Check(e.leaf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !hasClass(result, "wrong-status") {
+		t.Errorf("got class %s for a revoked certificate, want wrong-status", result.Class())
+	}
+	result, err = New(Options{ExpectStatus: ocsp.Revoked}).Check(e.leaf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := result.Err(); err != nil {
+		t.Errorf("violations when expecting revoked: %s", err)
+	}
+}
+
+func TestTooSoon(t *testing.T) {
+	e := newTestEnv(t, nil)
+	e.resp.Faults[responder.FaultStale] = true
+	result, err := New(Options{TooSoon: time.Hour}).CheckWithIssuer(e.leaf, e.ca.Cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !hasClass(result, "too-soon") {
+		t.Errorf("got class %s, violations %v for a stale response, want too-soon", result.Class(), result.Violations)
+	}
+}
+
+func TestCheckMethods(t *testing.T) {
+	for _, method := range []string{"GET", "POST"} {
+		t.Run(method, func(t *testing.T) {
+			var gotMethod string
+			e := newTestEnv(t, func(h http.Handler) http.Handler {
+				return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+					if r.URL.Path != "/issuer" {
+						gotMethod = r.Method
+					}
+					h.ServeHTTP(w, r)
+				})
+			})
+			result, err := New(Options{Method: method}).Check(e.leaf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := result.Err(); err != nil {
+				t.Errorf("violations: %s", err)
+			}
+			if gotMethod != method || result.Method != method {
+				t.Errorf("sent %s, recorded %s, want %s", gotMethod, result.Method, method)
+			}
+			if result.Response.Status != ocsp.Good {
+				t.Errorf("CertStatus %d, want good", result.Response.Status)
+			}
+			if !result.Issuer.Equal(e.ca.Cert) {
+				t.Errorf("issuer %s fetched via AIA, want %s", result.Issuer.Subject, e.ca.Cert.Subject)
+			}
+		})
+	}
+}
+
+func TestDelegatedResponder(t *testing.T) {
+	e := newTestEnv(t, nil)
+	cert, key, err := e.ca.Delegate("Test OCSP Responder")
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.resp.SignerCert, e.resp.Signer = cert, key
+	result, err := New(Options{}).CheckWithIssuer(e.leaf, e.ca.Cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := result.Err(); err != nil {
+		t.Errorf("violations: %s", err)
+	}
+	d := result.Delegated
+	if d == nil {
+		t.Fatal("delegated responder not recognized")
+	}
+	if !d.Cert.Equal(cert) || !d.OCSPSigning || !d.NoCheck || !d.IssuedByCA {
+		t.Errorf("got %+v, want the responder certificate, with OCSPSigning, NoCheck and IssuedByCA", d)
+	}
+}
+
+func TestErrorClasses(t *testing.T) {
+	testCases := []struct {
+		fault responder.Fault
+		opts  Options
+		class string
+	}{
+		{responder.FaultWrongSigner, Options{}, ClassSignature},
+		{responder.FaultMalformed, Options{}, ClassParse},
+		{responder.FaultServerError, Options{}, ClassHTTP},
+		{responder.FaultSlow, Options{Timeout: 50 * time.Millisecond}, ClassNetwork},
+	}
+	for _, tc := range testCases {
+		t.Run(string(tc.fault), func(t *testing.T) {
+			e := newTestEnv(t, nil)
+			e.resp.Faults[tc.fault] = true
+			e.resp.Delay = time.Second
+			result, _ := New(tc.opts).CheckWithIssuer(e.leaf, e.ca.Cert)
+			if result.ErrorClass != tc.class {
+				t.Errorf("got class %s, want %s", result.ErrorClass, tc.class)
+			}
+		})
+	}
+}
+
+// failFirst wraps a handler so that the first n OCSP requests get errResp
+// instead of an answer.
+type failFirst struct {
+	http.Handler
+	errResp []byte
+
+	mu       sync.Mutex
+	n        int
+	requests int
+}
+
+func (f *failFirst) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	f.requests++
+	fail := f.requests <= f.n
+	f.mu.Unlock()
+	if fail {
+		w.Header().Set("Content-Type", "application/ocsp-response")
+		w.Write(f.errResp)
+		return
+	}
+	f.Handler.ServeHTTP(w, r)
+}
+
+func TestRetry(t *testing.T) {
+	testCases := []struct {
+		name         string
+		errResp      []byte
+		wantAttempts int
+		wantErr      bool
+	}{
+		{"tryLater", ocsp.TryLaterErrorResponse, 3, false},
+		{"internalError", ocsp.InternalErrorErrorResponse, 1, true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var ff *failFirst
+			e := newTestEnv(t, func(h http.Handler) http.Handler {
+				ff = &failFirst{Handler: h, errResp: tc.errResp, n: 2}
+				return ff
+			})
+			opts := Options{Retries: 2, RetryBackoff: time.Millisecond}
+			result, err := New(opts).CheckWithIssuer(e.leaf, e.ca.Cert)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("got error %v, want error %t", err, tc.wantErr)
+			}
+			if result.Attempts != tc.wantAttempts || ff.requests != tc.wantAttempts {
+				t.Errorf("%d attempts recorded, %d made, want %d", result.Attempts, ff.requests, tc.wantAttempts)
+			}
+			if tc.wantErr && result.ErrorClass != ClassResponder {
+				t.Errorf("got class %s, want %s", result.ErrorClass, ClassResponder)
+			}
+		})
+	}
+}
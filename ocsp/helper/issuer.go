@@ -0,0 +1,340 @@
+package helper
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ReadCertificates reads one or more certificates from fileName. The file may
+// contain a single DER certificate or any number of PEM CERTIFICATE blocks,
+// such as the fullchain files written by ACME clients.
+func ReadCertificates(fileName string) ([]*x509.Certificate, error) {
+	contents, err := ioutil.ReadFile(fileName)
+	if err != nil {
+		return nil, err
+	}
+	certs, err := parseAll(contents)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", fileName, err)
+	}
+	return certs, nil
+}
+
+// parseAll parses every PEM certificate in body, or body as a single DER
+// certificate if it contains no PEM.
+func parseAll(body []byte) ([]*x509.Certificate, error) {
+	var certs []*x509.Certificate
+	rest := body
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		certs = append(certs, cert)
+	}
+	if len(certs) > 0 {
+		return certs, nil
+	}
+	cert, err := parse(body)
+	if err != nil {
+		return nil, err
+	}
+	return []*x509.Certificate{cert}, nil
+}
+
+// findIssuer returns the certificate among candidates that issued cert, or
+// nil if there is none. Candidates whose subject does not match cert's issuer,
+// or whose Subject Key Identifier does not match cert's Authority Key
+// Identifier, are skipped; of the rest, the first whose key verifies cert's
+// signature is returned.
+func findIssuer(cert *x509.Certificate, candidates []*x509.Certificate) *x509.Certificate {
+	for _, candidate := range candidates {
+		if !bytes.Equal(candidate.RawSubject, cert.RawIssuer) {
+			continue
+		}
+		if len(cert.AuthorityKeyId) > 0 && len(candidate.SubjectKeyId) > 0 &&
+			!bytes.Equal(cert.AuthorityKeyId, candidate.SubjectKeyId) {
+			continue
+		}
+		err := candidate.CheckSignature(cert.SignatureAlgorithm, cert.RawTBSCertificate, cert.Signature)
+		if err != nil {
+			continue
+		}
+		return candidate
+	}
+	return nil
+}
+
+// Issuer finds the issuer of chain[0] as CheckChain does: among the rest of
+// chain, then in Options.Issuers, and finally via AIA.
+func (c *Checker) Issuer(chain []*x509.Certificate) (*x509.Certificate, error) {
+	if len(chain) == 0 {
+		return nil, fmt.Errorf("no certificates")
+	}
+	return c.issuerFor(&Result{Cert: chain[0]}, chain[1:])
+}
+
+// issuerFor finds cert's issuer among chain and the configured issuers,
+// falling back to fetching it via AIA.
+func (c *Checker) issuerFor(result *Result, chain []*x509.Certificate) (*x509.Certificate, error) {
+	cert := result.Cert
+	if issuer := findIssuer(cert, chain); issuer != nil {
+		return issuer, nil
+	}
+	if issuer := findIssuer(cert, c.opts.Issuers); issuer != nil {
+		return issuer, nil
+	}
+	return c.getIssuer(result)
+}
+
+// issuerCacheMaxAge is how long issuers fetched via AIA are cached.
+const issuerCacheMaxAge = 7 * 24 * time.Hour
+
+// cachedIssuers are the certificates fetched from an AIA URL, and when.
+type cachedIssuers struct {
+	certs   []*x509.Certificate
+	fetched time.Time
+}
+
+// fresh reports whether the cached issuers may still be used.
+func (ci cachedIssuers) fresh() bool {
+	now := time.Now()
+	if now.Sub(ci.fetched) > issuerCacheMaxAge {
+		return false
+	}
+	for _, cert := range ci.certs {
+		if now.After(cert.NotAfter) {
+			return false
+		}
+	}
+	return true
+}
+
+// issuerFetch is an AIA fetch in progress. done is closed once certs and
+// err are set.
+type issuerFetch struct {
+	done  chan struct{}
+	certs []*x509.Certificate
+	err   error
+}
+
+// getIssuer fetches result.Cert's issuer via AIA, recording the request's
+// timing in result.IssuerTiming unless it was cached or fetched by another
+// check.
+func (c *Checker) getIssuer(result *Result) (*x509.Certificate, error) {
+	cert := result.Cert
+	if len(cert.IssuingCertificateURL) == 0 {
+		return nil, fmt.Errorf("No AIA information available, can't get issuer")
+	}
+	issuerURL := cert.IssuingCertificateURL[0]
+	candidates := c.cachedIssuers(issuerURL)
+	if candidates == nil {
+		var err error
+		candidates, err = c.fetchIssuersOnce(issuerURL, result)
+		if err != nil {
+			return nil, fmt.Errorf("from %s: %s", issuerURL, err)
+		}
+	}
+	issuer := findIssuer(cert, candidates)
+	if issuer == nil {
+		return nil, fmt.Errorf("from %s: none of %d certificates issued %s",
+			issuerURL, len(candidates), cert.Subject)
+	}
+	return issuer, nil
+}
+
+// fetchIssuersOnce fetches the certificates served at issuerURL and caches
+// them, unless another check is already fetching them, in which case it
+// waits for that fetch and shares its outcome.
+func (c *Checker) fetchIssuersOnce(issuerURL string, result *Result) ([]*x509.Certificate, error) {
+	c.mu.Lock()
+	if f, ok := c.fetching[issuerURL]; ok {
+		c.mu.Unlock()
+		<-f.done
+		return f.certs, f.err
+	}
+	f := &issuerFetch{done: make(chan struct{})}
+	c.fetching[issuerURL] = f
+	c.mu.Unlock()
+
+	result.IssuerTiming = new(Timing)
+	f.certs, f.err = c.fetchIssuers(issuerURL, result.IssuerTiming)
+	if f.err == nil {
+		c.cacheIssuers(issuerURL, f.certs)
+	}
+	c.mu.Lock()
+	delete(c.fetching, issuerURL)
+	c.mu.Unlock()
+	close(f.done)
+	return f.certs, f.err
+}
+
+// fetchIssuers fetches the certificates served at issuerURL, which may be a
+// single certificate or a PKCS#7 bundle, recording the request's timing.
+func (c *Checker) fetchIssuers(issuerURL string, timing *Timing) ([]*x509.Certificate, error) {
+	req, err := http.NewRequest("GET", issuerURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, body, err := c.roundTrip(req, timing)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("http status code %d", resp.StatusCode)
+	}
+	contentType := resp.Header.Get("Content-Type")
+	if strings.Contains(contentType, "pkcs7") || strings.HasSuffix(issuerURL, ".p7c") {
+		return parseCMS(body)
+	}
+	return parseAll(body)
+}
+
+// cachedIssuers returns the certificates previously fetched from issuerURL,
+// looking first in memory and then in IssuerCacheDir. It returns nil on a
+// miss, or if the cached certificates are no longer fresh.
+func (c *Checker) cachedIssuers(issuerURL string) []*x509.Certificate {
+	c.mu.Lock()
+	cached, ok := c.issuers[issuerURL]
+	c.mu.Unlock()
+	if ok && cached.fresh() {
+		return cached.certs
+	}
+	if c.opts.IssuerCacheDir == "" {
+		return nil
+	}
+	fileName := c.issuerCacheFile(issuerURL)
+	info, err := os.Stat(fileName)
+	if err != nil {
+		return nil
+	}
+	certs, err := ReadCertificates(fileName)
+	if err != nil {
+		return nil
+	}
+	cached = cachedIssuers{certs, info.ModTime()}
+	if !cached.fresh() {
+		return nil
+	}
+	c.mu.Lock()
+	c.issuers[issuerURL] = cached
+	c.mu.Unlock()
+	return certs
+}
+
+// cacheIssuers remembers issuers as the certificates served at issuerURL.
+// Errors writing the disk cache are ignored; the issuers will simply be
+// fetched again next time.
+func (c *Checker) cacheIssuers(issuerURL string, issuers []*x509.Certificate) {
+	c.mu.Lock()
+	c.issuers[issuerURL] = cachedIssuers{issuers, time.Now()}
+	c.mu.Unlock()
+	if c.opts.IssuerCacheDir == "" {
+		return
+	}
+	if err := os.MkdirAll(c.opts.IssuerCacheDir, 0755); err != nil {
+		return
+	}
+	var buf bytes.Buffer
+	for _, issuer := range issuers {
+		pem.Encode(&buf, &pem.Block{Type: "CERTIFICATE", Bytes: issuer.Raw})
+	}
+	fileName := c.issuerCacheFile(issuerURL)
+	tmp := fileName + ".tmp"
+	if err := ioutil.WriteFile(tmp, buf.Bytes(), 0644); err != nil {
+		return
+	}
+	os.Rename(tmp, fileName)
+}
+
+// issuerCacheFile returns the name of the file in which the issuers fetched
+// from issuerURL are cached.
+func (c *Checker) issuerCacheFile(issuerURL string) string {
+	sum := sha256.Sum256([]byte(issuerURL))
+	return filepath.Join(c.opts.IssuerCacheDir, hex.EncodeToString(sum[:])+".pem")
+}
+
+func parse(body []byte) (*x509.Certificate, error) {
+	block, _ := pem.Decode(body)
+	var der []byte
+	if block == nil {
+		der = body
+	} else {
+		der = block.Bytes
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	return cert, nil
+}
+
+var oidSignedData = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 2}
+
+// parseCMS parses the certificates from a CMS (PKCS#7) message of type
+// SignedData, as described in RFC 5652 section 5. This is the "certs-only"
+// format served by many AIA URLs. The message may be DER or PEM encoded. Any
+// signerInfos are ignored.
+func parseCMS(body []byte) ([]*x509.Certificate, error) {
+	if block, _ := pem.Decode(body); block != nil {
+		body = block.Bytes
+	}
+	type signedData struct {
+		Version          int
+		DigestAlgorithms asn1.RawValue
+		EncapContentInfo asn1.RawValue
+		Certificates     asn1.RawValue `asn1:"optional,tag:0"`
+		CRLs             asn1.RawValue `asn1:"optional,tag:1"`
+		SignerInfos      asn1.RawValue
+	}
+	type contentInfo struct {
+		ContentType asn1.ObjectIdentifier
+		Content     asn1.RawValue `asn1:"explicit,tag:0"`
+	}
+	var msg contentInfo
+	rest, err := asn1.Unmarshal(body, &msg)
+	if err != nil {
+		return nil, fmt.Errorf("parsing CMS: %s", err)
+	}
+	if len(rest) > 0 {
+		return nil, fmt.Errorf("parsing CMS: %d bytes of trailing data", len(rest))
+	}
+	if !msg.ContentType.Equal(oidSignedData) {
+		return nil, fmt.Errorf("parsing CMS: content type %s is not SignedData", msg.ContentType)
+	}
+	var sd signedData
+	rest, err = asn1.Unmarshal(msg.Content.Bytes, &sd)
+	if err != nil {
+		return nil, fmt.Errorf("parsing CMS SignedData: %s", err)
+	}
+	if len(rest) > 0 {
+		return nil, fmt.Errorf("parsing CMS SignedData: %d bytes of trailing data", len(rest))
+	}
+	if len(sd.Certificates.Bytes) == 0 {
+		return nil, fmt.Errorf("parsing CMS: SignedData contains no certificates")
+	}
+	certs, err := x509.ParseCertificates(sd.Certificates.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("parsing CMS certificates: %s", err)
+	}
+	return certs, nil
+}
@@ -0,0 +1,184 @@
+package helper
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jsha/go/ocsp/responder"
+)
+
+// certsOnly returns a CMS certs-only message holding the given certificates
+// in DER, as served at many AIA URLs.
+func certsOnly(t *testing.T, contentType asn1.ObjectIdentifier, certs ...[]byte) []byte {
+	t.Helper()
+	var certBytes []byte
+	for _, c := range certs {
+		certBytes = append(certBytes, c...)
+	}
+	data := struct {
+		Version          int
+		DigestAlgorithms asn1.RawValue
+		EncapContentInfo struct{ ContentType asn1.ObjectIdentifier }
+		Certificates     asn1.RawValue
+		SignerInfos      asn1.RawValue
+	}{
+		Version:          1,
+		DigestAlgorithms: asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSet, IsCompound: true},
+		Certificates:     asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: certBytes},
+		SignerInfos:      asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagSet, IsCompound: true},
+	}
+	data.EncapContentInfo.ContentType = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	inner, err := asn1.Marshal(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := asn1.Marshal(struct {
+		ContentType asn1.ObjectIdentifier
+		Content     asn1.RawValue
+	}{contentType, asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: inner}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return der
+}
+
+func TestParseCMS(t *testing.T) {
+	ca, err := responder.NewCA("Test CA")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cross, err := responder.NewCA("Test CA")
+	if err != nil {
+		t.Fatal(err)
+	}
+	two := certsOnly(t, oidSignedData, ca.Cert.Raw, cross.Cert.Raw)
+	testCases := []struct {
+		name      string
+		body      []byte
+		wantCerts int
+		wantErr   bool
+	}{
+		{"one", certsOnly(t, oidSignedData, ca.Cert.Raw), 1, false},
+		{"two", two, 2, false},
+		{"PEM", pem.EncodeToMemory(&pem.Block{Type: "PKCS7", Bytes: two}), 2, false},
+		{"no certificates", certsOnly(t, oidSignedData), 0, true},
+		{"not SignedData", certsOnly(t, asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}, ca.Cert.Raw), 0, true},
+		{"truncated", two[:len(two)-3], 0, true},
+		{"trailing data", append(append([]byte{}, two...), 0), 0, true},
+		{"bare certificate", ca.Cert.Raw, 0, true},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			certs, err := parseCMS(tc.body)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("got error %v, want error %t", err, tc.wantErr)
+			}
+			if len(certs) != tc.wantCerts {
+				t.Fatalf("got %d certificates, want %d", len(certs), tc.wantCerts)
+			}
+			if len(certs) > 0 && !certs[0].Equal(ca.Cert) {
+				t.Errorf("first certificate is %s, want %s", certs[0].Subject, ca.Cert.Subject)
+			}
+		})
+	}
+
+	// A leaf's issuer is picked out from the bundle by key, not name.
+	leaf, err := cross.Issue(big.NewInt(1), "example.com", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	certs, err := parseCMS(two)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if issuer := findIssuer(leaf, certs); issuer != certs[1] {
+		t.Errorf("findIssuer chose %v, want the second certificate", issuer)
+	}
+}
+
+// countAIA wraps a handler, counting requests for the issuer.
+type countAIA struct {
+	http.Handler
+	mu       sync.Mutex
+	requests int
+}
+
+func (c *countAIA) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/issuer" {
+		c.mu.Lock()
+		c.requests++
+		c.mu.Unlock()
+		// Give concurrent checks time to pile up behind this request.
+		time.Sleep(20 * time.Millisecond)
+	}
+	c.Handler.ServeHTTP(w, r)
+}
+
+func (c *countAIA) count() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.requests
+}
+
+func TestIssuerFetchedOnce(t *testing.T) {
+	counter := &countAIA{}
+	e := newTestEnv(t, func(h http.Handler) http.Handler {
+		counter.Handler = h
+		return counter
+	})
+	checker := New(Options{})
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if issuer, err := checker.Issuer([]*x509.Certificate{e.leaf}); err != nil || !issuer.Equal(e.ca.Cert) {
+				t.Errorf("got issuer %v, error %v", issuer, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := counter.count(); n != 1 {
+		t.Errorf("issuer fetched %d times, want once", n)
+	}
+}
+
+func TestIssuerCacheExpiry(t *testing.T) {
+	counter := &countAIA{}
+	e := newTestEnv(t, func(h http.Handler) http.Handler {
+		counter.Handler = h
+		return counter
+	})
+	dir, err := ioutil.TempDir("", "issuers")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	check := func(wantFetches int) {
+		t.Helper()
+		if _, err := New(Options{IssuerCacheDir: dir}).Issuer([]*x509.Certificate{e.leaf}); err != nil {
+			t.Fatal(err)
+		}
+		if n := counter.count(); n != wantFetches {
+			t.Errorf("issuer fetched %d times, want %d", n, wantFetches)
+		}
+	}
+	check(1)
+	// A new Checker finds the issuer on disk.
+	check(1)
+	// Once the cache file is older than issuerCacheMaxAge, it is ignored.
+	old := time.Now().Add(-issuerCacheMaxAge - time.Hour)
+	if err := os.Chtimes(New(Options{IssuerCacheDir: dir}).issuerCacheFile(e.leaf.IssuingCertificateURL[0]), old, old); err != nil {
+		t.Fatal(err)
+	}
+	check(2)
+	check(2)
+}
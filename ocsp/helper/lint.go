@@ -0,0 +1,264 @@
+package helper
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Severity ranks how serious a Violation is.
+type Severity int
+
+const (
+	SeverityNotice Severity = iota
+	SeverityWarning
+	SeverityError
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityNotice:
+		return "notice"
+	case SeverityWarning:
+		return "warning"
+	case SeverityError:
+		return "error"
+	}
+	return fmt.Sprintf("Severity(%d)", int(s))
+}
+
+// clockSkew is how far in the future a timestamp may be before it is
+// reported, to allow for clocks that are slightly off.
+const clockSkew = 5 * time.Minute
+
+// Lint is a single check applied to OCSP responses when Options.Lint is set.
+type Lint struct {
+	ID          string
+	Description string
+	// check returns a Violation for each problem found.
+	check func(r *Result) []Violation
+}
+
+// Lints is the suite run against every response when Options.Lint is set.
+// In addition, when alternates are fetched, responses that differ but share
+// an ETag are reported as "etag-consistency".
+var Lints = []Lint{
+	{"validity-interval", "thisUpdate to nextUpdate is between 8 hours and 10 days (BRs 4.9.10)", lintValidityInterval},
+	{"this-update-future", "thisUpdate is not in the future", lintThisUpdateFuture},
+	{"produced-at-skew", "producedAt is not in the future nor before thisUpdate", lintProducedAt},
+	{"next-update-missing", "nextUpdate is present (RFC 5019 section 2.2.4)", lintNextUpdateMissing},
+	{"responder-id-type", "responder ID is byKey (RFC 5019 section 2.2.3)", lintResponderID},
+	{"signature", "signature algorithm and signing key are acceptable (BRs 6.1.5, 7.1.3)", lintSignature},
+	{"content-type", "Content-Type is application/ocsp-response (RFC 6960 appendix A.2)", lintContentType},
+	{"cache-control", "Cache-Control max-age is present and does not outlive nextUpdate (RFC 5019 section 6.2)", lintCacheControl},
+	{"http-headers", "ETag is present; Last-Modified and Expires agree with producedAt/thisUpdate and nextUpdate (RFC 5019 section 6.2)", lintHTTPHeaders},
+	{"extensions", "response carries no unexpected extensions", lintExtensions},
+}
+
+func finding(id string, severity Severity, format string, args ...interface{}) []Violation {
+	return []Violation{{ID: id, Severity: severity, Message: fmt.Sprintf(format, args...)}}
+}
+
+// lint runs every lint in Lints against result, which must have a parsed
+// Response, and records the findings as violations.
+func lint(result *Result) {
+	for _, l := range Lints {
+		result.Violations = append(result.Violations, l.check(result)...)
+	}
+}
+
+func lintValidityInterval(r *Result) []Violation {
+	resp := r.Response
+	if resp.NextUpdate.IsZero() {
+		return nil
+	}
+	interval := resp.NextUpdate.Sub(resp.ThisUpdate)
+	if interval > 10*24*time.Hour {
+		return finding("validity-interval", SeverityError, "validity interval %s exceeds 10 days", interval)
+	}
+	if interval < 8*time.Hour {
+		return finding("validity-interval", SeverityError, "validity interval %s is shorter than 8 hours", interval)
+	}
+	return nil
+}
+
+func lintThisUpdateFuture(r *Result) []Violation {
+	if ahead := time.Until(r.Response.ThisUpdate); ahead > clockSkew {
+		return finding("this-update-future", SeverityError, "thisUpdate is %s in the future", ahead)
+	}
+	return nil
+}
+
+func lintProducedAt(r *Result) []Violation {
+	resp := r.Response
+	if ahead := time.Until(resp.ProducedAt); ahead > clockSkew {
+		return finding("produced-at-skew", SeverityWarning, "producedAt is %s in the future", ahead)
+	}
+	if resp.ProducedAt.Before(resp.ThisUpdate) {
+		return finding("produced-at-skew", SeverityNotice, "producedAt is %s before thisUpdate",
+			resp.ThisUpdate.Sub(resp.ProducedAt))
+	}
+	return nil
+}
+
+func lintNextUpdateMissing(r *Result) []Violation {
+	if r.Response.NextUpdate.IsZero() {
+		return finding("next-update-missing", SeverityError, "response has no nextUpdate")
+	}
+	return nil
+}
+
+func lintResponderID(r *Result) []Violation {
+	if len(r.Response.RawResponderName) > 0 {
+		return finding("responder-id-type", SeverityNotice, "responder ID is byName rather than byKey")
+	}
+	return nil
+}
+
+func lintSignature(r *Result) []Violation {
+	resp := r.Response
+	var found []Violation
+	switch resp.SignatureAlgorithm {
+	case x509.SHA1WithRSA, x509.ECDSAWithSHA1, x509.DSAWithSHA1, x509.MD5WithRSA, x509.MD2WithRSA:
+		found = append(found, finding("signature", SeverityError,
+			"weak signature algorithm %s", resp.SignatureAlgorithm)...)
+	}
+	signer := r.Issuer
+	if resp.Certificate != nil {
+		signer = resp.Certificate
+	}
+	if signer == nil {
+		return found
+	}
+	if desc, severity, bad := describeKey(signer.PublicKey); bad {
+		found = append(found, finding("signature", severity, "signing key is %s", desc)...)
+	}
+	return found
+}
+
+// describeKey returns a short description of pub, such as "RSA 2048" or
+// "ECDSA P-256", and whether, and how seriously, it falls short of the
+// Baseline Requirements.
+func describeKey(pub interface{}) (desc string, severity Severity, bad bool) {
+	switch key := pub.(type) {
+	case *rsa.PublicKey:
+		bits := key.N.BitLen()
+		return fmt.Sprintf("RSA %d", bits), SeverityError, bits < 2048
+	case *ecdsa.PublicKey:
+		name := key.Curve.Params().Name
+		return "ECDSA " + name, SeverityError, name != "P-256" && name != "P-384"
+	case ed25519.PublicKey:
+		return "Ed25519", SeverityWarning, true
+	}
+	return fmt.Sprintf("unknown %T", pub), SeverityError, true
+}
+
+func lintContentType(r *Result) []Violation {
+	if ct := r.Header.Get("Content-Type"); ct != "application/ocsp-response" {
+		return finding("content-type", SeverityError, "Content-Type is %q", ct)
+	}
+	return nil
+}
+
+// maxAge returns the max-age directive from header's Cache-Control, and
+// whether it was present.
+func maxAge(header http.Header) (time.Duration, bool) {
+	for _, directive := range strings.Split(header.Get("Cache-Control"), ",") {
+		directive = strings.TrimSpace(directive)
+		if !strings.HasPrefix(directive, "max-age=") {
+			continue
+		}
+		seconds, err := strconv.Atoi(strings.TrimPrefix(directive, "max-age="))
+		if err != nil {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+	return 0, false
+}
+
+func lintCacheControl(r *Result) []Violation {
+	age, ok := maxAge(r.Header)
+	if !ok {
+		return finding("cache-control", SeverityWarning, "no Cache-Control max-age")
+	}
+	if r.Response.NextUpdate.IsZero() {
+		return nil
+	}
+	if remaining := time.Until(r.Response.NextUpdate); age > remaining+clockSkew {
+		return finding("cache-control", SeverityError, "max-age %s outlives nextUpdate, which is %s away",
+			age, remaining.Truncate(time.Second))
+	}
+	return nil
+}
+
+func lintHTTPHeaders(r *Result) []Violation {
+	resp := r.Response
+	var found []Violation
+	if lm := r.Header.Get("Last-Modified"); lm != "" {
+		t, err := http.ParseTime(lm)
+		if err != nil {
+			found = append(found, finding("http-headers", SeverityWarning, "unparseable Last-Modified %q", lm)...)
+		} else if !sameSecond(t, resp.ProducedAt) && !sameSecond(t, resp.ThisUpdate) {
+			found = append(found, finding("http-headers", SeverityWarning,
+				"Last-Modified %s matches neither producedAt nor thisUpdate", t)...)
+		}
+	}
+	if exp := r.Header.Get("Expires"); exp != "" && !resp.NextUpdate.IsZero() {
+		t, err := http.ParseTime(exp)
+		if err != nil {
+			found = append(found, finding("http-headers", SeverityWarning, "unparseable Expires %q", exp)...)
+		} else if t.After(resp.NextUpdate) {
+			found = append(found, finding("http-headers", SeverityError,
+				"Expires %s is after nextUpdate %s", t, resp.NextUpdate)...)
+		}
+	}
+	if r.Header.Get("ETag") == "" {
+		found = append(found, finding("http-headers", SeverityNotice, "no ETag")...)
+	}
+	return found
+}
+
+func sameSecond(a, b time.Time) bool {
+	return a.Truncate(time.Second).Equal(b.Truncate(time.Second))
+}
+
+func lintExtensions(r *Result) []Violation {
+	var found []Violation
+	for _, ext := range r.Response.Extensions {
+		found = append(found, finding("extensions", SeverityNotice, "singleExtension %s", ext.Id)...)
+	}
+	exts, err := responseExtensions(r.Response.TBSResponseData)
+	if err != nil {
+		return append(found, finding("extensions", SeverityError, "parsing responseExtensions: %s", err)...)
+	}
+	for _, ext := range exts {
+		if ext.Id.Equal(oidNonce) && len(r.Nonce) > 0 {
+			continue
+		}
+		found = append(found, finding("extensions", SeverityNotice, "responseExtension %s", ext.Id)...)
+	}
+	return found
+}
+
+// lintETags reports alternates that serve different responses under the same
+// ETag as result, which would confuse caches.
+func lintETags(result *Result) {
+	etag := result.Header.Get("ETag")
+	if etag == "" || result.RawResponse == nil {
+		return
+	}
+	for _, alt := range result.Alternates {
+		if alt.Header.Get("ETag") == etag && alt.RawResponse != nil &&
+			string(alt.RawResponse) != string(result.RawResponse) {
+			result.Violations = append(result.Violations, finding("etag-consistency", SeverityError,
+				"%s %s serves a different response with the same ETag %s", alt.Method, alt.URL, etag)...)
+		}
+	}
+}
@@ -0,0 +1,28 @@
+package helper
+
+import (
+	"testing"
+
+	"github.com/jsha/go/ocsp/responder"
+)
+
+func TestLint(t *testing.T) {
+	e := newTestEnv(t, nil)
+	result, err := New(Options{Lint: true}).CheckWithIssuer(e.leaf, e.ca.Cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := result.Err(); err != nil {
+		t.Errorf("violations for a well-behaved responder: %s", err)
+	}
+
+	e = newTestEnv(t, nil)
+	e.resp.Faults[responder.FaultContentType] = true
+	result, err = New(Options{Lint: true}).CheckWithIssuer(e.leaf, e.ca.Cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !hasClass(result, "content-type") {
+		t.Errorf("got violations %v for a text/plain response, want content-type", result.Violations)
+	}
+}
@@ -0,0 +1,75 @@
+package helper
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+	"fmt"
+	"time"
+)
+
+// oidTLSFeature identifies the TLS Feature extension defined in RFC 7633.
+var oidTLSFeature = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 1, 24}
+
+// statusRequest is the TLS extension number for status_request. A TLS
+// Feature extension listing it is what's commonly called Must-Staple.
+const statusRequest = 5
+
+// MustStaple reports whether cert has a TLS Feature extension containing
+// status_request.
+func MustStaple(cert *x509.Certificate) (bool, error) {
+	for _, ext := range cert.Extensions {
+		if !ext.Id.Equal(oidTLSFeature) {
+			continue
+		}
+		var features []int
+		rest, err := asn1.Unmarshal(ext.Value, &features)
+		if err != nil {
+			return false, fmt.Errorf("parsing TLS Feature extension: %s", err)
+		}
+		if len(rest) > 0 {
+			return false, fmt.Errorf("parsing TLS Feature extension: trailing data")
+		}
+		for _, f := range features {
+			if f == statusRequest {
+				return true, nil
+			}
+		}
+	}
+	return false, nil
+}
+
+// detectMustStaple records whether result.Cert is Must-Staple.
+func detectMustStaple(result *Result) {
+	mustStaple, err := MustStaple(result.Cert)
+	if err != nil {
+		result.addViolation("must-staple-malformed", "%s", err)
+		return
+	}
+	result.MustStaple = mustStaple
+}
+
+// enforceMustStaple adds violations to a result from CheckTLS if its
+// certificate is Must-Staple but the server did not staple a valid,
+// unexpired response for it.
+func (c *Checker) enforceMustStaple(result *Result) {
+	if !result.MustStaple || !c.opts.EnforceMustStaple {
+		return
+	}
+	switch {
+	case len(result.RawStapled) == 0:
+		result.addViolation("must-staple-missing", "certificate is Must-Staple but %s did not staple a response",
+			result.Addr)
+	case result.StapledResponse == nil && result.Issuer == nil:
+		// Without the issuer the staple could not be parsed or verified.
+		result.addViolation("must-staple-unverified", "staple unverified: issuer unknown")
+	case result.StapledResponse == nil:
+		// The parse failure was already recorded as staple-invalid.
+		result.addViolation("must-staple-invalid", "certificate is Must-Staple but the stapled response is invalid")
+	case time.Now().After(result.StapledResponse.NextUpdate):
+		result.addViolation("must-staple-expired", "stapled response expired at %s",
+			result.StapledResponse.NextUpdate)
+	case result.StapledResponse.Status != c.opts.ExpectStatus:
+		result.addViolation("must-staple-status", "stapled CertStatus %d, expected %d",
+			result.StapledResponse.Status, c.opts.ExpectStatus)
+	}
+}
@@ -0,0 +1,130 @@
+package helper
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Print writes a human-readable account of r to w, in the same format the
+// ocsp command has always used.
+func (r *Result) Print(w io.Writer) {
+	if r.Skipped {
+		fmt.Fprintf(w, "Skipping expired certificate (NotAfter %s)\n", r.Cert.NotAfter)
+		return
+	}
+	if r.Addr != "" {
+		defer r.printStaple(w)
+	}
+	// Violations are printed however far the check got.
+	defer r.printViolations(w)
+	if r.IssuerTiming != nil {
+		fmt.Fprintf(w, "Timing AIA %s\n", r.IssuerTiming)
+	}
+	if r.DryRun {
+		fmt.Fprintf(w, "Not sending %s request to %s\n", r.Method, r.Server)
+		fmt.Fprintf(w, "Request %s\n", base64.StdEncoding.EncodeToString(r.RawRequest))
+		fmt.Fprintf(w, "GET URL %s\n", GetURL(r.Server, r.RawRequest))
+		for _, alt := range r.Alternates {
+			fmt.Fprintf(w, "Not sending %s request to %s\n", alt.Method, alt.Server)
+		}
+		return
+	}
+	switch r.Method {
+	case "":
+		return
+	case "POST":
+		fmt.Fprintf(w, "POSTing request, reproduce with: curl -i --data-binary @- %s < <(base64 -d <<<%s)\n",
+			r.URL, base64.StdEncoding.EncodeToString(r.RawRequest))
+	default:
+		fmt.Fprintf(w, "Fetching %s\n", r.URL)
+	}
+	if r.FetchTiming.Total > 0 {
+		fmt.Fprintf(w, "Timing OCSP %s\n", &r.FetchTiming)
+	}
+	if r.HTTPStatus == 0 {
+		return
+	}
+	fmt.Fprintf(w, "HTTP %d\n", r.HTTPStatus)
+	for k, v := range r.Header {
+		for _, vv := range v {
+			fmt.Fprintf(w, "%s: %s\n", k, vv)
+		}
+	}
+	if len(r.RawResponse) > 0 {
+		fmt.Fprintf(w, "\nDecoding body: %s\n", base64.StdEncoding.EncodeToString(r.RawResponse))
+	}
+	resp := r.Response
+	if resp == nil {
+		return
+	}
+	fmt.Fprintf(w, "\n")
+	if r.Err() == nil {
+		fmt.Fprintf(w, "Good response:\n")
+	} else {
+		fmt.Fprintf(w, "Response:\n")
+	}
+	fmt.Fprintf(w, "  CertStatus %d\n", resp.Status)
+	fmt.Fprintf(w, "  SerialNumber %036x\n", resp.SerialNumber)
+	fmt.Fprintf(w, "  ProducedAt %s\n", resp.ProducedAt)
+	fmt.Fprintf(w, "  ThisUpdate %s\n", resp.ThisUpdate)
+	fmt.Fprintf(w, "  NextUpdate %s\n", resp.NextUpdate)
+	fmt.Fprintf(w, "  RevokedAt %s\n", resp.RevokedAt)
+	fmt.Fprintf(w, "  RevocationReason %d\n", resp.RevocationReason)
+	fmt.Fprintf(w, "  SignatureAlgorithm %s\n", resp.SignatureAlgorithm)
+	fmt.Fprintf(w, "  Extensions %#v\n", resp.Extensions)
+	if d := r.Delegated; d != nil {
+		fmt.Fprintf(w, "  Responder %s (serial %x)\n", d.Cert.Subject, d.Cert.SerialNumber)
+		fmt.Fprintf(w, "    NotBefore %s NotAfter %s (expires in %s)\n",
+			d.Cert.NotBefore, d.Cert.NotAfter, d.ExpiresIn.Truncate(time.Hour))
+		fmt.Fprintf(w, "    OCSPSigning %t NoCheck %t IssuedByCA %t Key %s\n",
+			d.OCSPSigning, d.NoCheck, d.IssuedByCA, d.KeyType)
+	}
+	if len(r.Nonce) > 0 {
+		fmt.Fprintf(w, "  Nonce %x echoed %t\n", r.Nonce, r.NonceEchoed)
+	}
+	for _, alt := range r.Alternates {
+		alt.printSummary(w)
+	}
+}
+
+func (r *Result) printViolations(w io.Writer) {
+	for _, v := range r.Violations {
+		fmt.Fprintf(w, "  Violation [%s] %s\n", v.Severity, v)
+	}
+}
+
+// printSummary writes a one-line summary of an alternate result.
+func (r *Result) printSummary(w io.Writer) {
+	fmt.Fprintf(w, "  Alternate %s %s: ", r.Method, r.URL)
+	switch {
+	case r.Response != nil:
+		fmt.Fprintf(w, "CertStatus %d ThisUpdate %s NextUpdate %s signer %s\n",
+			r.Response.Status, r.Response.ThisUpdate, r.Response.NextUpdate, signer(r.Response))
+	case r.HTTPStatus != 0:
+		fmt.Fprintf(w, "HTTP %d, no valid response\n", r.HTTPStatus)
+	default:
+		fmt.Fprintf(w, "no response\n")
+	}
+}
+
+func (r *Result) printStaple(w io.Writer) {
+	fmt.Fprintf(w, "  MustStaple %t\n", r.MustStaple)
+	switch {
+	case len(r.RawStapled) == 0:
+		fmt.Fprintf(w, "  Stapled none\n")
+	case r.StapledResponse == nil && r.Issuer == nil:
+		fmt.Fprintf(w, "  Stapled unverified: issuer unknown\n")
+	case r.StapledResponse == nil:
+		fmt.Fprintf(w, "  Stapled invalid: %s\n", base64.StdEncoding.EncodeToString(r.RawStapled))
+	default:
+		diffs := r.StapleDifferences()
+		if len(diffs) == 0 {
+			fmt.Fprintf(w, "  Stapled matches responder\n")
+		}
+		for _, d := range diffs {
+			fmt.Fprintf(w, "  Stapled differs: %s\n", d)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package helper
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+// StatusString returns the name of an OCSP CertStatus: "good", "revoked",
+// "unknown".
+func StatusString(status int) string {
+	switch status {
+	case ocsp.Good:
+		return "good"
+	case ocsp.Revoked:
+		return "revoked"
+	case ocsp.Unknown:
+		return "unknown"
+	}
+	return fmt.Sprintf("status-%d", status)
+}
+
+// MarshalText encodes s as its name, so that it appears readably in JSON.
+func (s Severity) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// UnmarshalText decodes a Severity written by MarshalText.
+func (s *Severity) UnmarshalText(text []byte) error {
+	for _, sev := range []Severity{SeverityNotice, SeverityWarning, SeverityError} {
+		if string(text) == sev.String() {
+			*s = sev
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown severity %q", text)
+}
+
+// Record is a flat, JSON-friendly summary of a Result.
+type Record struct {
+	Name             string      `json:"name,omitempty"`
+	Serial           string      `json:"serial,omitempty"`
+	Issuer           string      `json:"issuer,omitempty"`
+	Responder        string      `json:"responder,omitempty"`
+	Server           string      `json:"server,omitempty"`
+	Method           string      `json:"method,omitempty"`
+	URL              string      `json:"url,omitempty"`
+	Attempts         int         `json:"attempts,omitempty"`
+	HTTPStatus       int         `json:"http_status,omitempty"`
+	Status           string      `json:"status,omitempty"`
+	ProducedAt       *time.Time  `json:"produced_at,omitempty"`
+	ThisUpdate       *time.Time  `json:"this_update,omitempty"`
+	NextUpdate       *time.Time  `json:"next_update,omitempty"`
+	RevokedAt        *time.Time  `json:"revoked_at,omitempty"`
+	RevocationReason *int        `json:"revocation_reason,omitempty"`
+	Start            *time.Time  `json:"start,omitempty"`
+	DurationMS       float64     `json:"duration_ms"`
+	AIATiming        *Timing     `json:"aia_timing,omitempty"`
+	OCSPTiming       *Timing     `json:"ocsp_timing,omitempty"`
+	Class            string      `json:"class"`
+	Error            string      `json:"error,omitempty"`
+	Violations       []Violation `json:"violations,omitempty"`
+	// Reproduction is set by the caller when it has written the request
+	// to files instead of sending it.
+	Reproduction *Reproduction `json:"reproduction,omitempty"`
+}
+
+// Record summarizes r. name identifies the certificate, for instance by file
+// name, and err is the error returned along with r, if any.
+func (r *Result) Record(name string, err error) Record {
+	rec := Record{
+		Name:       name,
+		Server:     r.Server,
+		Method:     r.Method,
+		URL:        r.URL,
+		Attempts:   r.Attempts,
+		HTTPStatus: r.HTTPStatus,
+		DurationMS: float64(r.Duration) / float64(time.Millisecond),
+		Class:      r.Class(),
+		Violations: r.Violations,
+		Responder:  r.Responder(),
+	}
+	if !r.Start.IsZero() {
+		rec.Start = &r.Start
+	}
+	rec.AIATiming = r.IssuerTiming
+	if r.FetchTiming.Total > 0 {
+		rec.OCSPTiming = &r.FetchTiming
+	}
+	if r.Serial != nil {
+		rec.Serial = fmt.Sprintf("%036x", r.Serial)
+	}
+	if r.Issuer != nil {
+		rec.Issuer = r.Issuer.Subject.String()
+	}
+	if err != nil {
+		rec.Error = err.Error()
+	}
+	if resp := r.Response; resp != nil {
+		rec.Status = StatusString(resp.Status)
+		rec.ProducedAt = &resp.ProducedAt
+		rec.ThisUpdate = &resp.ThisUpdate
+		if !resp.NextUpdate.IsZero() {
+			rec.NextUpdate = &resp.NextUpdate
+		}
+		if resp.Status == ocsp.Revoked {
+			rec.RevokedAt = &resp.RevokedAt
+			rec.RevocationReason = &resp.RevocationReason
+		}
+	}
+	return rec
+}
+
+// Responder returns the host of the OCSP responder r was fetched from, or
+// the empty string if no request was made.
+func (r *Result) Responder() string {
+	if r.URL == "" {
+		return ""
+	}
+	u, err := url.Parse(r.URL)
+	if err != nil {
+		return ""
+	}
+	return u.Host
+}
@@ -0,0 +1,35 @@
+package helper
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+func TestRecordRevocationReason(t *testing.T) {
+	testCases := []struct {
+		name string
+		resp ocsp.Response
+		want string
+	}{
+		{"good", ocsp.Response{Status: ocsp.Good}, ""},
+		{"revoked, unspecified", ocsp.Response{Status: ocsp.Revoked, RevocationReason: ocsp.Unspecified}, `"revocation_reason":0`},
+		{"revoked, key compromise", ocsp.Response{Status: ocsp.Revoked, RevocationReason: ocsp.KeyCompromise}, `"revocation_reason":1`},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			line, err := json.Marshal((&Result{Response: &tc.resp}).Record("", nil))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := strings.Contains(string(line), `"revocation_reason"`)
+			if tc.want == "" && got {
+				t.Errorf("%s has a revocation reason", line)
+			} else if tc.want != "" && !strings.Contains(string(line), tc.want) {
+				t.Errorf("%s does not contain %s", line, tc.want)
+			}
+		})
+	}
+}
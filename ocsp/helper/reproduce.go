@@ -0,0 +1,114 @@
+package helper
+
+import (
+	"crypto"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+// ReproductionName returns a name for r's reproduction files, made of a
+// prefix of its issuer's key hash and its serial, so that certificates with
+// the same serial from different issuers don't collide.
+func (r *Result) ReproductionName() string {
+	if r.Issuer != nil {
+		if _, keyHash, err := issuerHashes(r.Issuer, crypto.SHA1); err == nil {
+			return fmt.Sprintf("%x-%x", keyHash[:8], r.Serial)
+		}
+	}
+	return fmt.Sprintf("%x", r.Serial)
+}
+
+// Reproduction lists the files WriteReproduction wrote and the commands that
+// send the requests in them.
+type Reproduction struct {
+	Files    []string `json:"files"`
+	Commands []string `json:"commands"`
+}
+
+// WriteReproduction writes r's request to files whose names begin with
+// prefix, so that it can be sent again by hand or handed to someone else:
+//
+//	prefix.der         the DER request
+//	prefix.b64         its base64 encoding
+//	prefix.url         the RFC 5019 GET URL
+//	prefix-issuer.pem  the issuer, for verifying responses
+//	prefix.sh          the commands below, runnable from any directory
+//
+// The request to each responder in r.Alternates is written the same way,
+// with "-2", "-3" and so on appended to prefix. The files and the commands
+// that send the requests refer to the files by their paths from the current
+// directory.
+func (r *Result) WriteReproduction(prefix string) (*Reproduction, error) {
+	repro := &Reproduction{}
+	if err := r.writeReproduction(prefix, repro); err != nil {
+		return nil, err
+	}
+	for i, alt := range r.Alternates {
+		if err := alt.writeReproduction(fmt.Sprintf("%s-%d", prefix, i+2), repro); err != nil {
+			return nil, err
+		}
+	}
+	return repro, nil
+}
+
+// writeReproduction writes r's request, adding the files and commands to
+// repro.
+func (r *Result) writeReproduction(prefix string, repro *Reproduction) error {
+	if r.RawRequest == nil || r.Issuer == nil || r.Server == "" {
+		return fmt.Errorf("no request to reproduce")
+	}
+	encoded := base64.StdEncoding.EncodeToString(r.RawRequest)
+	files := []struct {
+		suffix   string
+		contents []byte
+	}{
+		{".der", r.RawRequest},
+		{".b64", []byte(encoded + "\n")},
+		{".url", []byte(GetURL(r.Server, r.RawRequest) + "\n")},
+		{"-issuer.pem", pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: r.Issuer.Raw})},
+	}
+	for _, f := range files {
+		if err := ioutil.WriteFile(prefix+f.suffix, f.contents, 0644); err != nil {
+			return err
+		}
+		repro.Files = append(repro.Files, prefix+f.suffix)
+	}
+	script := "#!/bin/sh\n# OCSP request for serial " + fmt.Sprintf("%x", r.Serial) + " to " + r.Server + "\nset -e\ncd \"$(dirname \"$0\")\"\n"
+	for _, cmd := range r.ReproduceCommands(filepath.Base(prefix)) {
+		script += cmd + "\n"
+	}
+	if err := ioutil.WriteFile(prefix+".sh", []byte(script), 0755); err != nil {
+		return err
+	}
+	repro.Files = append(repro.Files, prefix+".sh")
+	repro.Commands = append(repro.Commands, r.ReproduceCommands(prefix)...)
+	return nil
+}
+
+// ReproduceCommands returns shell commands that send r's request with curl,
+// using GET and POST, and with openssl ocsp, and that decode the response
+// curl saves. They expect the files written by WriteReproduction with the
+// same prefix.
+func (r *Result) ReproduceCommands(prefix string) []string {
+	der, issuer, resp := shellQuote(prefix+".der"), shellQuote(prefix+"-issuer.pem"), shellQuote(prefix+".resp")
+	server := shellQuote(r.Server)
+	verify := fmt.Sprintf("-issuer %s -CAfile %s -partial_chain -resp_text", issuer, issuer)
+	return []string{
+		fmt.Sprintf("curl -sS -D - -o %s %s", resp, shellQuote(GetURL(r.Server, r.RawRequest))),
+		fmt.Sprintf("curl -sS -D - -o %s -H 'Content-Type: application/ocsp-request' --data-binary @%s %s", resp, der, server),
+		fmt.Sprintf("openssl ocsp -reqin %s -url %s %s", der, server, verify),
+		fmt.Sprintf("openssl ocsp -respin %s %s", resp, verify),
+	}
+}
+
+// shellQuote quotes s for a POSIX shell, if it needs it.
+func shellQuote(s string) string {
+	if s != "" && strings.Trim(s, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_./:@") == "" {
+		return s
+	}
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
@@ -0,0 +1,98 @@
+package helper
+
+import (
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jsha/go/ocsp/responder"
+)
+
+func TestWriteReproduction(t *testing.T) {
+	ca, err := responder.NewCA("Test CA")
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(0x1234),
+		Subject:      pkix.Name{CommonName: "example.com"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		OCSPServer:   []string{"http://ocsp1.example/", "http://ocsp2.example/"},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.Cert, ca.Key.Public(), ca.Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err := New(Options{DryRun: true, AllResponders: true}).CheckWithIssuer(leaf, ca.Cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.Alternates) != 1 || result.Alternates[0].Server != "http://ocsp2.example/" {
+		t.Fatalf("got %d alternates, want one for the second responder", len(result.Alternates))
+	}
+
+	// The same serial from another issuer gets another name.
+	other, err := responder.NewCA("Test CA")
+	if err != nil {
+		t.Fatal(err)
+	}
+	name := result.ReproductionName()
+	if otherName := (&Result{Serial: result.Serial, Issuer: other.Cert}).ReproductionName(); otherName == name {
+		t.Errorf("serial %x from two issuers both named %s", result.Serial, name)
+	}
+	if !strings.HasSuffix(name, "-1234") {
+		t.Errorf("name %s does not end in the serial", name)
+	}
+
+	dir, err := ioutil.TempDir("", "reproduce")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	prefix := filepath.Join(dir, name)
+	repro, err := result.WriteReproduction(prefix)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, server := range []string{"http://ocsp1.example/", "http://ocsp2.example/"} {
+		p := prefix
+		if i > 0 {
+			p += "-2"
+		}
+		script, err := ioutil.ReadFile(p + ".sh")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(script), server) {
+			t.Errorf("%s.sh does not send to %s:\n%s", p, server, script)
+		}
+		for _, suffix := range []string{".der", ".b64", ".url", "-issuer.pem"} {
+			if _, err := os.Stat(p + suffix); err != nil {
+				t.Error(err)
+			}
+		}
+	}
+	if want := 2 * len(result.ReproduceCommands(prefix)); len(repro.Commands) != want {
+		t.Errorf("got %d commands, want %d", len(repro.Commands), want)
+	}
+	if len(repro.Files) != 10 {
+		t.Errorf("got files %v, want five for each responder", repro.Files)
+	}
+	for _, f := range repro.Files {
+		if _, err := os.Stat(f); err != nil {
+			t.Error(err)
+		}
+	}
+}
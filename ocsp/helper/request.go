@@ -0,0 +1,216 @@
+package helper
+
+import (
+	"crypto"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"fmt"
+	"math/big"
+	"net/url"
+	"strings"
+
+	_ "crypto/sha1"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+)
+
+// maxGetURLLength is the longest GET URL RFC 5019 section 5 allows; longer
+// requests must be sent with POST.
+const maxGetURLLength = 255
+
+var hashOIDs = map[crypto.Hash]asn1.ObjectIdentifier{
+	crypto.SHA1:   asn1.ObjectIdentifier{1, 3, 14, 3, 2, 26},
+	crypto.SHA256: asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1},
+	crypto.SHA384: asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 2},
+	crypto.SHA512: asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 3},
+}
+
+// oidNonce identifies the OCSP nonce extension from RFC 8954.
+var oidNonce = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 48, 1, 2}
+
+type certID struct {
+	HashAlgorithm  pkix.AlgorithmIdentifier
+	IssuerNameHash []byte
+	IssuerKeyHash  []byte
+	SerialNumber   *big.Int
+}
+
+type request struct {
+	Cert certID
+}
+
+type tbsRequest struct {
+	Version           int              `asn1:"explicit,tag:0,default:0,optional"`
+	RequestorName     pkix.RDNSequence `asn1:"explicit,tag:1,optional"`
+	RequestList       []request
+	RequestExtensions []pkix.Extension `asn1:"explicit,tag:2,optional"`
+}
+
+type ocspRequest struct {
+	TBSRequest tbsRequest
+}
+
+// ParseHash returns the hash named by name, which may be "sha1", "sha256",
+// "sha384" or "sha512".
+func ParseHash(name string) (crypto.Hash, error) {
+	switch strings.ToLower(strings.Replace(name, "-", "", -1)) {
+	case "sha1":
+		return crypto.SHA1, nil
+	case "sha256":
+		return crypto.SHA256, nil
+	case "sha384":
+		return crypto.SHA384, nil
+	case "sha512":
+		return crypto.SHA512, nil
+	}
+	return 0, fmt.Errorf("unsupported hash %q", name)
+}
+
+// CreateRequest returns a DER-encoded OCSP request for the certificate with
+// the given serial number issued by issuer. Unlike ocsp.CreateRequest it
+// does not need the certificate itself. hash is used to compute the CertID;
+// if zero, SHA-1 is used as RFC 5019 requires. If nonce is non-empty it is
+// included in a nonce extension.
+func CreateRequest(serial *big.Int, issuer *x509.Certificate, hash crypto.Hash, nonce []byte) ([]byte, error) {
+	if hash == 0 {
+		hash = crypto.SHA1
+	}
+	oid, ok := hashOIDs[hash]
+	if !ok {
+		return nil, fmt.Errorf("unsupported hash %s", hash)
+	}
+	issuerNameHash, issuerKeyHash, err := issuerHashes(issuer, hash)
+	if err != nil {
+		return nil, err
+	}
+
+	req := ocspRequest{
+		TBSRequest: tbsRequest{
+			RequestList: []request{{
+				Cert: certID{
+					HashAlgorithm: pkix.AlgorithmIdentifier{
+						Algorithm:  oid,
+						Parameters: asn1.RawValue{Tag: asn1.TagNull},
+					},
+					IssuerNameHash: issuerNameHash,
+					IssuerKeyHash:  issuerKeyHash,
+					SerialNumber:   serial,
+				},
+			}},
+		},
+	}
+	if len(nonce) > 0 {
+		value, err := asn1.Marshal(nonce)
+		if err != nil {
+			return nil, err
+		}
+		req.TBSRequest.RequestExtensions = []pkix.Extension{{Id: oidNonce, Value: value}}
+	}
+	return asn1.Marshal(req)
+}
+
+// issuerHashes returns the hashes of issuer's name and public key used in
+// a CertID.
+func issuerHashes(issuer *x509.Certificate, hash crypto.Hash) (nameHash, keyHash []byte, err error) {
+	if !hash.Available() {
+		return nil, nil, fmt.Errorf("unsupported hash %s", hash)
+	}
+	var spki struct {
+		Algorithm pkix.AlgorithmIdentifier
+		PublicKey asn1.BitString
+	}
+	if _, err := asn1.Unmarshal(issuer.RawSubjectPublicKeyInfo, &spki); err != nil {
+		return nil, nil, fmt.Errorf("parsing issuer public key: %s", err)
+	}
+	h := hash.New()
+	h.Write(issuer.RawSubject)
+	nameHash = h.Sum(nil)
+	h.Reset()
+	h.Write(spki.PublicKey.RightAlign())
+	keyHash = h.Sum(nil)
+	return nameHash, keyHash, nil
+}
+
+// hashForOID returns the hash identified by oid, or zero if it is not
+// known.
+func hashForOID(oid asn1.ObjectIdentifier) crypto.Hash {
+	for hash, hashOID := range hashOIDs {
+		if oid.Equal(hashOID) {
+			return hash
+		}
+	}
+	return 0
+}
+
+// GetURL returns the URL for fetching req from server with GET, as
+// described in RFC 5019 section 5: the URL-encoded base64 of the request is
+// appended to server's path.
+func GetURL(server string, req []byte) string {
+	encoded := url.QueryEscape(base64.StdEncoding.EncodeToString(req))
+	if !strings.HasSuffix(server, "/") {
+		server += "/"
+	}
+	return server + encoded
+}
+
+// responseExtensions returns the responseExtensions from the tbsResponseData
+// of an OCSP response, which ocsp.Response does not expose.
+func responseExtensions(tbsResponseData []byte) ([]pkix.Extension, error) {
+	var data struct {
+		Version            int `asn1:"optional,default:0,explicit,tag:0"`
+		ResponderID        asn1.RawValue
+		ProducedAt         asn1.RawValue
+		Responses          asn1.RawValue
+		ResponseExtensions []pkix.Extension `asn1:"explicit,tag:1,optional"`
+	}
+	if _, err := asn1.Unmarshal(tbsResponseData, &data); err != nil {
+		return nil, err
+	}
+	return data.ResponseExtensions, nil
+}
+
+// checkNonce records whether result.Response echoes the nonce that was
+// sent, adding a violation if it returned a different one.
+func checkNonce(result *Result) {
+	if len(result.Nonce) == 0 || result.Response == nil {
+		return
+	}
+	exts, err := responseExtensions(result.Response.TBSResponseData)
+	if err != nil {
+		result.addViolation("malformed-extensions", "parsing response extensions: %s", err)
+		return
+	}
+	for _, ext := range exts {
+		if !ext.Id.Equal(oidNonce) {
+			continue
+		}
+		var nonce []byte
+		if _, err := asn1.Unmarshal(ext.Value, &nonce); err != nil {
+			// Some responders omit the inner OCTET STRING.
+			nonce = ext.Value
+		}
+		if string(nonce) != string(result.Nonce) {
+			result.addViolation("nonce-mismatch", "response nonce %x, sent %x", nonce, result.Nonce)
+			return
+		}
+		result.NonceEchoed = true
+	}
+}
+
+// ParseSerial parses a certificate serial number in the given base (16 or
+// 10). Hex serials may have a "0x" prefix and may be separated by colons or
+// spaces, as tools commonly print them.
+func ParseSerial(s string, base int) (*big.Int, error) {
+	s = strings.TrimSpace(s)
+	if base == 16 {
+		s = strings.TrimPrefix(strings.TrimPrefix(s, "0x"), "0X")
+		s = strings.NewReplacer(":", "", " ", "").Replace(s)
+	}
+	serial, ok := new(big.Int).SetString(s, base)
+	if !ok {
+		return nil, fmt.Errorf("invalid base %d serial %q", base, s)
+	}
+	return serial, nil
+}
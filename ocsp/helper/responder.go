@@ -0,0 +1,94 @@
+package helper
+
+import (
+	"crypto/x509"
+	"encoding/asn1"
+	"time"
+)
+
+// oidOCSPNoCheck identifies the id-pkix-ocsp-nocheck extension from RFC 6960
+// section 4.2.2.2.1.
+var oidOCSPNoCheck = asn1.ObjectIdentifier{1, 3, 6, 1, 5, 5, 7, 48, 1, 5}
+
+// DelegatedResponder describes the certificate a delegated OCSP responder
+// included in its response.
+type DelegatedResponder struct {
+	Cert *x509.Certificate
+	// OCSPSigning is true if Cert has the id-kp-OCSPSigning EKU.
+	OCSPSigning bool
+	// NoCheck is true if Cert has the id-pkix-ocsp-nocheck extension.
+	NoCheck bool
+	// IssuedByCA is true if Cert's signature verifies with the issuer's key.
+	IssuedByCA bool
+	// KeyType describes Cert's public key, e.g. "ECDSA P-256".
+	KeyType string
+	// ExpiresIn is the time remaining until Cert's NotAfter.
+	ExpiresIn time.Duration
+}
+
+// checkResponder fills in result.Delegated if the response was signed by a
+// delegated responder, and records violations for any problems with its
+// certificate. Responder certificates expiring within warnBefore are
+// reported as warnings.
+func checkResponder(result *Result, warnBefore time.Duration) {
+	resp := result.Response
+	if resp == nil || resp.Certificate == nil {
+		return
+	}
+	cert := resp.Certificate
+	d := &DelegatedResponder{
+		Cert:      cert,
+		ExpiresIn: time.Until(cert.NotAfter),
+	}
+	result.Delegated = d
+	for _, eku := range cert.ExtKeyUsage {
+		if eku == x509.ExtKeyUsageOCSPSigning {
+			d.OCSPSigning = true
+		}
+	}
+	for _, ext := range cert.Extensions {
+		if ext.Id.Equal(oidOCSPNoCheck) {
+			d.NoCheck = true
+		}
+	}
+	if result.Issuer != nil {
+		d.IssuedByCA = cert.CheckSignatureFrom(result.Issuer) == nil
+	}
+	desc, severity, bad := describeKey(cert.PublicKey)
+	d.KeyType = desc
+
+	if !d.OCSPSigning {
+		result.addViolation("responder-eku", "responder certificate lacks the OCSPSigning EKU")
+	}
+	if !d.NoCheck {
+		result.Violations = append(result.Violations, Violation{
+			ID:       "responder-nocheck",
+			Severity: SeverityWarning,
+			Message:  "responder certificate lacks id-pkix-ocsp-nocheck",
+		})
+	}
+	if result.Issuer != nil && !d.IssuedByCA {
+		result.addViolation("responder-issuer", "responder certificate was not issued by %s", result.Issuer.Subject)
+	}
+	if bad {
+		result.Violations = append(result.Violations, Violation{
+			ID:       "responder-key",
+			Severity: severity,
+			Message:  "responder certificate key is " + desc,
+		})
+	}
+	switch {
+	case cert.NotBefore.After(resp.ProducedAt):
+		result.addViolation("responder-validity", "responder certificate NotBefore %s is after producedAt %s",
+			cert.NotBefore, resp.ProducedAt)
+	case !resp.NextUpdate.IsZero() && cert.NotAfter.Before(resp.NextUpdate):
+		result.addViolation("responder-validity", "responder certificate NotAfter %s is before nextUpdate %s",
+			cert.NotAfter, resp.NextUpdate)
+	case d.ExpiresIn < warnBefore:
+		result.Violations = append(result.Violations, Violation{
+			ID:       "responder-expiring",
+			Severity: SeverityWarning,
+			Message:  "responder certificate expires in " + d.ExpiresIn.Truncate(time.Hour).String(),
+		})
+	}
+}
@@ -0,0 +1,152 @@
+package helper
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+)
+
+// Timing breaks an HTTP request down into phases. Phases that did not
+// happen, such as DNS and Connect on a reused connection, are zero.
+type Timing struct {
+	DNS     time.Duration
+	Connect time.Duration
+	TLS     time.Duration
+	// FirstByte is the time from the request being written to the first
+	// byte of the response, roughly the server's processing time.
+	FirstByte time.Duration
+	// Body is the time spent reading the response body after the headers.
+	Body  time.Duration
+	Total time.Duration
+}
+
+// Phase is one named phase of a Timing.
+type Phase struct {
+	Name     string
+	Duration time.Duration
+}
+
+// Phases returns the phases of t in the order they happen, followed by the
+// total. Names are suitable for use as metric labels.
+func (t *Timing) Phases() []Phase {
+	return []Phase{
+		{"dns", t.DNS},
+		{"connect", t.Connect},
+		{"tls", t.TLS},
+		{"first_byte", t.FirstByte},
+		{"body", t.Body},
+		{"total", t.Total},
+	}
+}
+
+func (t *Timing) String() string {
+	var buf bytes.Buffer
+	for i, p := range t.Phases() {
+		if i > 0 {
+			buf.WriteString(" ")
+		}
+		fmt.Fprintf(&buf, "%s=%s", p.Name, p.Duration.Round(time.Microsecond))
+	}
+	return buf.String()
+}
+
+// MarshalJSON encodes t as an object of phase durations in milliseconds.
+func (t *Timing) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString("{")
+	for i, p := range t.Phases() {
+		if i > 0 {
+			buf.WriteString(",")
+		}
+		fmt.Fprintf(&buf, "%q:%g", p.Name+"_ms", float64(p.Duration)/float64(time.Millisecond))
+	}
+	buf.WriteString("}")
+	return buf.Bytes(), nil
+}
+
+// tracer collects the timestamps of one request's phases. The transport may
+// call its hooks from several goroutines, for instance when dialing multiple
+// addresses at once.
+type tracer struct {
+	mu                   sync.Mutex
+	start                time.Time
+	dnsStart, dnsDone    time.Time
+	connStart, connDone  time.Time
+	tlsStart, tlsDone    time.Time
+	wrote, firstByte     time.Time
+	headersDone, bodyEnd time.Time
+}
+
+func (t *tracer) mark(at *time.Time) {
+	t.mu.Lock()
+	*at = time.Now()
+	t.mu.Unlock()
+}
+
+func (t *tracer) clientTrace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) { t.mark(&t.dnsStart) },
+		DNSDone:  func(httptrace.DNSDoneInfo) { t.mark(&t.dnsDone) },
+		ConnectStart: func(string, string) {
+			t.mu.Lock()
+			if t.connStart.IsZero() {
+				t.connStart = time.Now()
+			}
+			t.mu.Unlock()
+		},
+		ConnectDone:          func(string, string, error) { t.mark(&t.connDone) },
+		TLSHandshakeStart:    func() { t.mark(&t.tlsStart) },
+		TLSHandshakeDone:     func(tls.ConnectionState, error) { t.mark(&t.tlsDone) },
+		WroteRequest:         func(httptrace.WroteRequestInfo) { t.mark(&t.wrote) },
+		GotFirstResponseByte: func() { t.mark(&t.firstByte) },
+	}
+}
+
+// between returns the time from a to b, or zero if either did not happen.
+func between(a, b time.Time) time.Duration {
+	if a.IsZero() || b.IsZero() {
+		return 0
+	}
+	return b.Sub(a)
+}
+
+func (t *tracer) timing() Timing {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return Timing{
+		DNS:       between(t.dnsStart, t.dnsDone),
+		Connect:   between(t.connStart, t.connDone),
+		TLS:       between(t.tlsStart, t.tlsDone),
+		FirstByte: between(t.wrote, t.firstByte),
+		Body:      between(t.headersDone, t.bodyEnd),
+		Total:     between(t.start, t.bodyEnd),
+	}
+}
+
+// roundTrip sends req with the Checker's timeout, reads the whole response
+// body and records how long each phase took in timing. The response is
+// returned whenever headers were received, even if reading the body failed;
+// its Body has already been closed.
+func (c *Checker) roundTrip(req *http.Request, timing *Timing) (*http.Response, []byte, error) {
+	t := &tracer{start: time.Now()}
+	defer func() { *timing = t.timing() }()
+	ctx, cancel := context.WithTimeout(req.Context(), c.opts.Timeout)
+	defer cancel()
+	ctx = httptrace.WithClientTrace(ctx, t.clientTrace())
+	resp, err := c.client.Do(req.WithContext(ctx))
+	if err != nil {
+		t.mark(&t.bodyEnd)
+		return nil, nil, err
+	}
+	t.mark(&t.headersDone)
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	t.mark(&t.bodyEnd)
+	return resp, body, err
+}
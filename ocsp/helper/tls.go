@@ -0,0 +1,70 @@
+package helper
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+// CheckTLS performs a TLS handshake with addr, requesting a stapled OCSP
+// response, and checks the OCSP status of the leaf certificate the server
+// presents. The issuer is taken from the presented chain when possible.
+// serverName is sent as SNI; if empty, the host part of addr is used.
+//
+// The server's chain is not verified; it is only used as a source of
+// certificates.
+func (c *Checker) CheckTLS(addr, serverName string) (*Result, error) {
+	if serverName == "" {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, err
+		}
+		serverName = host
+	}
+	dialer := &net.Dialer{Timeout: c.opts.Timeout}
+	conn, err := tls.DialWithDialer(dialer, "tcp", addr, &tls.Config{
+		ServerName:         serverName,
+		InsecureSkipVerify: true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("connecting to %s: %s", addr, err)
+	}
+	state := conn.ConnectionState()
+	conn.Close()
+	if len(state.PeerCertificates) == 0 {
+		return nil, fmt.Errorf("%s presented no certificates", addr)
+	}
+
+	result, err := c.CheckChain(state.PeerCertificates)
+	if result == nil {
+		return nil, err
+	}
+	result.Addr = addr
+	result.RawStapled = state.OCSPResponse
+	if len(state.OCSPResponse) > 0 && result.Issuer != nil {
+		stapled, stapleErr := ocsp.ParseResponseForCert(state.OCSPResponse, result.Cert, result.Issuer)
+		if stapleErr != nil {
+			result.addViolation("staple-invalid", "parsing stapled response: %s", stapleErr)
+		} else {
+			result.StapledResponse = stapled
+			if result.Response != nil && stapled.Status != result.Response.Status {
+				result.addViolation("staple-mismatch", "stapled CertStatus %d, responder says %d",
+					stapled.Status, result.Response.Status)
+			}
+		}
+	}
+	c.enforceMustStaple(result)
+	return result, err
+}
+
+// StapleDifferences describes how the stapled response differs from the one
+// fetched from the responder. It returns nil if either is missing or they
+// agree.
+func (r *Result) StapleDifferences() []string {
+	if r.StapledResponse == nil || r.Response == nil {
+		return nil
+	}
+	return compareResponses(r.StapledResponse, r.Response)
+}
@@ -1,24 +1,222 @@
 package main
 
 import (
+	"bufio"
+	"bytes"
+	"encoding/json"
 	"flag"
+	"fmt"
 	"log"
 	"os"
+	"path/filepath"
+	"sort"
+	"sync"
 
 	"github.com/jsha/go/ocsp/helper"
 )
 
+var options = helper.RegisterFlags(flag.CommandLine)
+var connect = flag.String("connect", "", "Check the certificate presented by this TLS server (host:port) instead of files")
+var serverName = flag.String("servername", "", "SNI to send with -connect (default: host from -connect)")
+var serial = flag.String("serial", "", "Check this serial number, issued by -issuer, at -url, instead of files")
+var serialBase = flag.Int("serial-base", 16, "Base of -serial (16 or 10)")
+var parallel = flag.Int("parallel", 1, "Number of certificates to check concurrently")
+var list = flag.String("list", "", "File containing names of certificate files to check, one per line (- for stdin)")
+var jsonOutput = flag.Bool("json", false, "Print one JSON object per certificate instead of verbose output")
+var dryRun = flag.String("dry-run", "", "Instead of sending requests, write them to this directory with curl and openssl commands to send them")
+var summary = flag.Bool("summary", false, "Print a summary grouped by status, responder and error class when done")
+
 func main() {
 	flag.Parse()
-	var errors bool
+	if *parallel < 1 {
+		log.Fatalf("-parallel must be at least 1, not %d", *parallel)
+	}
+	opts, err := options()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *dryRun != "" {
+		if err := os.MkdirAll(*dryRun, 0755); err != nil {
+			log.Fatal(err)
+		}
+		opts.DryRun = true
+	}
+	checker := helper.New(opts)
+	r := newReporter(opts)
+	if *connect != "" {
+		result, err := checker.CheckTLS(*connect, *serverName)
+		r.report(*connect, result, err)
+	}
+	if *serial != "" {
+		result, err := checkSerial(checker, opts)
+		r.report(*serial, result, err)
+	}
+
+	files := make(chan string)
+	var wg sync.WaitGroup
+	for i := 0; i < *parallel; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for f := range files {
+				result, err := checker.Req(f)
+				r.report(f, result, err)
+			}
+		}()
+	}
 	for _, f := range flag.Args() {
-		_, err := helper.Req(f)
-		if err != nil {
-			log.Printf("error for %s: %s\n", f, err)
-			errors = true
+		files <- f
+	}
+	if *list != "" {
+		if err := readList(*list, files); err != nil {
+			log.Print(err)
+			r.errors = true
 		}
 	}
-	if errors {
+	close(files)
+	wg.Wait()
+
+	if *summary {
+		r.printSummary()
+	}
+	if r.errors {
 		os.Exit(1)
 	}
 }
+
+// readList sends each non-empty line of fileName to files.
+func readList(fileName string, files chan<- string) error {
+	f := os.Stdin
+	if fileName != "-" {
+		var err error
+		f, err = os.Open(fileName)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+	}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if line := scanner.Text(); line != "" {
+			files <- line
+		}
+	}
+	return scanner.Err()
+}
+
+func checkSerial(checker *helper.Checker, opts helper.Options) (*helper.Result, error) {
+	n, err := helper.ParseSerial(*serial, *serialBase)
+	if err != nil {
+		return nil, err
+	}
+	if len(opts.Issuers) == 0 {
+		return nil, fmt.Errorf("-serial requires -issuer")
+	}
+	return checker.CheckSerial(n, opts.Issuers[0])
+}
+
+// reporter prints results as they arrive, possibly from several goroutines,
+// and tallies them for the summary.
+type reporter struct {
+	opts helper.Options
+
+	sync.Mutex
+	errors      bool
+	total       int
+	byStatus    map[string]int
+	byResponder map[string]int
+	byClass     map[string]int
+}
+
+func newReporter(opts helper.Options) *reporter {
+	return &reporter{
+		opts:        opts,
+		byStatus:    make(map[string]int),
+		byResponder: make(map[string]int),
+		byClass:     make(map[string]int),
+	}
+}
+
+func (r *reporter) report(name string, result *helper.Result, err error) {
+	if result == nil {
+		result = &helper.Result{ErrorClass: helper.ClassInput}
+	}
+	if verr := result.Err(); err == nil {
+		err = verr
+	} else if verr != nil {
+		err = fmt.Errorf("%s; %s", err, verr)
+	}
+	var repro *helper.Reproduction
+	if err == nil && result.DryRun {
+		repro, err = result.WriteReproduction(filepath.Join(*dryRun, result.ReproductionName()))
+	}
+	var buf bytes.Buffer
+	if *jsonOutput {
+		rec := result.Record(name, err)
+		rec.Reproduction = repro
+		json.NewEncoder(&buf).Encode(rec)
+	} else {
+		result.Print(&buf)
+		if r.opts.EnforceMustStaple && result.Addr == "" && result.Cert != nil {
+			fmt.Fprintf(&buf, "Must-Staple: %t\n", result.MustStaple)
+		}
+		if repro != nil {
+			for _, cmd := range repro.Commands {
+				fmt.Fprintf(&buf, "  %s\n", cmd)
+			}
+		}
+	}
+
+	r.Lock()
+	defer r.Unlock()
+	os.Stdout.Write(buf.Bytes())
+	if err != nil {
+		if !*jsonOutput {
+			log.Printf("error for %s: %s\n", name, err)
+		}
+		r.errors = true
+	}
+	r.total++
+	status := "none"
+	if result.Response != nil {
+		status = helper.StatusString(result.Response.Status)
+	}
+	r.byStatus[status]++
+	if responder := result.Responder(); responder != "" {
+		r.byResponder[responder]++
+	}
+	r.byClass[result.Class()]++
+}
+
+func (r *reporter) printSummary() {
+	r.Lock()
+	defer r.Unlock()
+	fmt.Fprintf(os.Stderr, "\nChecked %d certificates\n", r.total)
+	for _, group := range []struct {
+		name   string
+		counts map[string]int
+	}{
+		{"status", r.byStatus},
+		{"responder", r.byResponder},
+		{"class", r.byClass},
+	} {
+		fmt.Fprintf(os.Stderr, "By %s:\n", group.name)
+		for _, key := range sortedKeys(group.counts) {
+			fmt.Fprintf(os.Stderr, "  %8d %s\n", group.counts[key], key)
+		}
+	}
+}
+
+func sortedKeys(m map[string]int) []string {
+	var keys []string
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if m[keys[i]] != m[keys[j]] {
+			return m[keys[i]] > m[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+	return keys
+}
@@ -0,0 +1,80 @@
+// ocsp_decode prints the contents of OCSP requests and responses. Each
+// argument may be a file or a literal value, in DER, PEM, base64, or as a
+// full GET URL. With no arguments, input is read from stdin.
+package main
+
+import (
+	"crypto/x509"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+
+	"github.com/jsha/go/ocsp/helper"
+)
+
+var issuerFile = flag.String("issuer", "", "Issuer certificate to verify signatures and CertIDs against")
+var kind = flag.String("type", "auto", "Type of input: request, response, or auto")
+
+func main() {
+	flag.Parse()
+	var issuer *x509.Certificate
+	if *issuerFile != "" {
+		certs, err := helper.ReadCertificates(*issuerFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		issuer = certs[0]
+	}
+	args := flag.Args()
+	if len(args) == 0 {
+		args = []string{"-"}
+	}
+	var errors bool
+	for _, arg := range args {
+		if err := decode(arg, issuer); err != nil {
+			log.Printf("error for %s: %s\n", arg, err)
+			errors = true
+		}
+	}
+	if errors {
+		os.Exit(1)
+	}
+}
+
+// read returns the contents of the file named by arg, stdin if arg is "-",
+// or arg itself if no such file exists.
+func read(arg string) ([]byte, error) {
+	if arg == "-" {
+		return ioutil.ReadAll(os.Stdin)
+	}
+	contents, err := ioutil.ReadFile(arg)
+	if os.IsNotExist(err) {
+		return []byte(arg), nil
+	}
+	return contents, err
+}
+
+func decode(arg string, issuer *x509.Certificate) error {
+	input, err := read(arg)
+	if err != nil {
+		return err
+	}
+	der, err := helper.DecodeInput(input)
+	if err != nil {
+		return err
+	}
+	switch *kind {
+	case "request":
+		return helper.PrintRequest(os.Stdout, der, issuer)
+	case "response":
+		return helper.PrintResponse(os.Stdout, der, issuer)
+	case "auto":
+		if helper.IsRequest(der) {
+			return helper.PrintRequest(os.Stdout, der, issuer)
+		}
+		return helper.PrintResponse(os.Stdout, der, issuer)
+	}
+	return fmt.Errorf("invalid -type %q", *kind)
+}
@@ -0,0 +1,256 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jsha/go/ocsp/helper"
+	prom "github.com/prometheus/client_golang/prometheus"
+)
+
+// urlList is a flag that may be given more than once.
+type urlList []string
+
+func (l *urlList) String() string { return strings.Join(*l, ",") }
+
+func (l *urlList) Set(s string) error {
+	*l = append(*l, s)
+	return nil
+}
+
+// Kinds of alert.
+const (
+	kindStatusChange = "status-change"
+	kindStale        = "stale"
+	kindNextUpdate   = "next-update"
+	kindErrors       = "errors"
+)
+
+// alert is the JSON payload POSTed to each webhook. State is "firing" when a
+// condition starts, or is still true after the repeat interval, and
+// "resolved" when it clears. Status changes are single events and are only
+// ever sent as "firing". A firing alert that a webhook fails to accept is
+// sent to it again after the next check.
+type alert struct {
+	Kind    string        `json:"kind"`
+	State   string        `json:"state"`
+	File    string        `json:"file"`
+	Serial  string        `json:"serial,omitempty"`
+	Server  string        `json:"server,omitempty"`
+	Message string        `json:"message"`
+	Time    time.Time     `json:"time"`
+	Record  helper.Record `json:"record"`
+}
+
+// alertState is what the alerter remembers about one file.
+type alertState struct {
+	status string
+	errors int
+	// firing holds each active condition.
+	firing map[string]*firingState
+	// changes are status changes that some webhook has yet to receive.
+	changes []delivery
+}
+
+// firingState is an active condition: when it was last sent, and to which
+// webhooks that failed. Those get it again on the next check, and only the
+// others are told when it resolves.
+type firingState struct {
+	sent        time.Time
+	undelivered []string
+}
+
+// delivery is an alert and the webhooks to send it to.
+type delivery struct {
+	alert    alert
+	webhooks []string
+}
+
+// alerter turns the results of successive checks into deduplicated
+// webhook notifications. A zero threshold disables the corresponding alert.
+type alerter struct {
+	webhooks  []string
+	maxAge    time.Duration
+	minNext   time.Duration
+	maxErrors int
+	repeat    time.Duration
+	client    *http.Client
+
+	mu    sync.Mutex
+	files map[string]*alertState
+}
+
+func newAlerter(webhooks []string, maxAge, minNext time.Duration, maxErrors int, repeat time.Duration) *alerter {
+	return &alerter{
+		webhooks:  webhooks,
+		maxAge:    maxAge,
+		minNext:   minNext,
+		maxErrors: maxErrors,
+		repeat:    repeat,
+		client:    &http.Client{Timeout: 10 * time.Second},
+		files:     make(map[string]*alertState),
+	}
+}
+
+// observe evaluates the alert conditions for f after a check and sends any
+// notifications they call for.
+func (a *alerter) observe(f string, result *helper.Result, err error) {
+	if len(a.webhooks) == 0 {
+		return
+	}
+	var rec helper.Record
+	if result != nil {
+		rec = result.Record(f, err)
+	} else {
+		rec = helper.Record{Name: f, Class: helper.ClassInput}
+		if err != nil {
+			rec.Error = err.Error()
+		}
+	}
+	now := time.Now()
+	var deliveries []delivery
+	add := func(kind, state string, webhooks []string, format string, args ...interface{}) {
+		deliveries = append(deliveries, delivery{alert{
+			Kind:    kind,
+			State:   state,
+			File:    f,
+			Serial:  rec.Serial,
+			Server:  rec.Server,
+			Message: fmt.Sprintf(format, args...),
+			Time:    now,
+			Record:  rec,
+		}, webhooks})
+	}
+
+	a.mu.Lock()
+	state, ok := a.files[f]
+	if !ok {
+		state = &alertState{firing: make(map[string]*firingState)}
+		a.files[f] = state
+	}
+	deliveries = append(deliveries, state.changes...)
+	state.changes = nil
+	// condition records whether kind is currently true, adding an alert
+	// when it starts, repeats, clears, or has yet to reach some webhook.
+	condition := func(kind string, active bool, format string, args ...interface{}) {
+		firing, wasFiring := state.firing[kind]
+		switch {
+		case active && (!wasFiring || a.repeat > 0 && now.Sub(firing.sent) >= a.repeat):
+			state.firing[kind] = &firingState{sent: now}
+			add(kind, "firing", a.webhooks, format, args...)
+		case active && len(firing.undelivered) > 0:
+			add(kind, "firing", firing.undelivered, format, args...)
+		case !active && wasFiring:
+			delete(state.firing, kind)
+			if told := without(a.webhooks, firing.undelivered); len(told) > 0 {
+				add(kind, "resolved", told, "%s no longer applies", kind)
+			}
+		}
+	}
+
+	if err != nil {
+		state.errors++
+	} else {
+		state.errors = 0
+	}
+	if a.maxErrors > 0 {
+		condition(kindErrors, state.errors >= a.maxErrors,
+			"%d consecutive errors, last: %s", state.errors, rec.Error)
+	}
+	if result != nil && result.Response != nil {
+		resp := result.Response
+		status := helper.StatusString(resp.Status)
+		if state.status != "" && status != state.status {
+			add(kindStatusChange, "firing", a.webhooks, "status changed from %s to %s", state.status, status)
+		}
+		state.status = status
+		if a.maxAge > 0 {
+			age := now.Sub(resp.ThisUpdate)
+			condition(kindStale, age > a.maxAge, "response is %s old", age.Truncate(time.Second))
+		}
+		if a.minNext > 0 && !resp.NextUpdate.IsZero() {
+			left := resp.NextUpdate.Sub(now)
+			condition(kindNextUpdate, left < a.minNext, "nextUpdate is only %s away", left.Truncate(time.Second))
+		}
+	}
+	a.mu.Unlock()
+
+	failed := make([][]string, len(deliveries))
+	for i, d := range deliveries {
+		failed[i] = a.send(d.alert, d.webhooks)
+	}
+
+	// Remember which firing alerts didn't get through, to send them again
+	// after the next check.
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for i, d := range deliveries {
+		if d.alert.State != "firing" {
+			continue
+		}
+		if d.alert.Kind == kindStatusChange {
+			if len(failed[i]) > 0 {
+				state.changes = append(state.changes, delivery{d.alert, failed[i]})
+			}
+		} else if firing, ok := state.firing[d.alert.Kind]; ok {
+			firing.undelivered = failed[i]
+		}
+	}
+}
+
+// without returns the webhooks not in exclude.
+func without(webhooks, exclude []string) []string {
+	var rest []string
+outer:
+	for _, w := range webhooks {
+		for _, e := range exclude {
+			if w == e {
+				continue outer
+			}
+		}
+		rest = append(rest, w)
+	}
+	return rest
+}
+
+// forget drops f, which is no longer monitored. Conditions that were firing
+// for it are not resolved.
+func (a *alerter) forget(f string) {
+	a.mu.Lock()
+	delete(a.files, f)
+	a.mu.Unlock()
+}
+
+// send POSTs al to each of webhooks and returns those it could not be
+// delivered to. Failures are logged and counted.
+func (a *alerter) send(al alert, webhooks []string) []string {
+	body, err := json.Marshal(al)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "encoding alert: %s\n", err)
+		return webhooks
+	}
+	var failed []string
+	for _, webhook := range webhooks {
+		resp, err := a.client.Post(webhook, "application/json", bytes.NewReader(body))
+		if err == nil {
+			resp.Body.Close()
+			if resp.StatusCode/100 != 2 {
+				err = fmt.Errorf("http status code %d", resp.StatusCode)
+			}
+		}
+		if err != nil {
+			webhook_errors.With(prom.Labels{"kind": al.Kind}).Inc()
+			fmt.Fprintf(os.Stderr, "sending %s alert for %s to %s: %s\n", al.Kind, al.File, webhook, err)
+			failed = append(failed, webhook)
+			continue
+		}
+		webhook_alerts.With(prom.Labels{"kind": al.Kind, "state": al.State}).Inc()
+	}
+	return failed
+}
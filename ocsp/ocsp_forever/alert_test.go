@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// webhook records the alerts POSTed to it, failing while down is set.
+type webhook struct {
+	mu     sync.Mutex
+	down   bool
+	states []string
+}
+
+func (h *webhook) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.down {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		return
+	}
+	var al alert
+	if err := json.NewDecoder(r.Body).Decode(&al); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	h.states = append(h.states, al.Kind+" "+al.State)
+}
+
+func (h *webhook) setDown(down bool) {
+	h.mu.Lock()
+	h.down = down
+	h.mu.Unlock()
+}
+
+func (h *webhook) received() string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return strings.Join(h.states, ", ")
+}
+
+func TestAlertRetry(t *testing.T) {
+	failing := errors.New("connection refused")
+	testCases := []struct {
+		name   string
+		checks []error
+		want   string
+	}{
+		// The firing alert is sent again once the webhook is back, and
+		// then resolved.
+		{"retried", []error{failing, failing, nil}, "errors firing, errors resolved"},
+		// The condition clears before the webhook is back, so the
+		// receiver hears nothing rather than a lone resolve.
+		{"resolved before delivery", []error{failing, nil, nil}, ""},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			up, flaky := &webhook{}, &webhook{}
+			upSrv, flakySrv := httptest.NewServer(up), httptest.NewServer(flaky)
+			defer upSrv.Close()
+			defer flakySrv.Close()
+			a := newAlerter([]string{upSrv.URL, flakySrv.URL}, 0, 0, 1, 0)
+			for i, err := range tc.checks {
+				flaky.setDown(i == 0)
+				a.observe("test.pem", nil, err)
+			}
+			if got := up.received(); got != "errors firing, errors resolved" {
+				t.Errorf("working webhook got %q", got)
+			}
+			if got := flaky.received(); got != tc.want {
+				t.Errorf("flaky webhook got %q, want %q", got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/jsha/go/ocsp/helper"
+	prom "github.com/prometheus/client_golang/prometheus"
+)
+
+// seen is the newest response observed for one file.
+type seen struct {
+	serial     *big.Int
+	thisUpdate time.Time
+	producedAt time.Time
+}
+
+// cadence follows how often responders publish new responses. Each check's
+// thisUpdate and producedAt are compared with the newest seen before for
+// the same file: a later time means the responder published a new response
+// since the last check, and an earlier one means something, typically a
+// cache, served an older response than it already had.
+//
+// Since checks only sample the responder, an observed interval is the time
+// between the responses seen, which can be longer than the true interval if
+// checks are less frequent than updates.
+type cadence struct {
+	mu    sync.Mutex
+	files map[string]seen
+}
+
+func newCadence() *cadence {
+	return &cadence{files: make(map[string]seen)}
+}
+
+func (c *cadence) observe(f string, result *helper.Result) {
+	resp := result.Response
+	if resp == nil {
+		return
+	}
+	responder := result.Responder()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	last, ok := c.files[f]
+	if !ok || last.serial.Cmp(result.Serial) != 0 {
+		c.files[f] = seen{result.Serial, resp.ThisUpdate, resp.ProducedAt}
+		return
+	}
+	updated := false
+	compare := func(field string, prev *time.Time, now time.Time) {
+		switch {
+		case now.After(*prev):
+			response_update_interval_seconds.With(prom.Labels{"field": field}).Observe(now.Sub(*prev).Seconds())
+			*prev = now
+			updated = true
+		case now.Before(*prev):
+			response_regressions.With(prom.Labels{"field": field, "responder": responder}).Inc()
+		}
+	}
+	compare("this_update", &last.thisUpdate, resp.ThisUpdate)
+	compare("produced_at", &last.producedAt, resp.ProducedAt)
+	if updated {
+		response_updates.With(prom.Labels{"responder": responder}).Inc()
+	}
+	c.files[f] = last
+}
+
+// forget drops f, which is no longer monitored.
+func (c *cadence) forget(f string) {
+	c.mu.Lock()
+	delete(c.files, f)
+	c.mu.Unlock()
+}
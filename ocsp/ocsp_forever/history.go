@@ -0,0 +1,268 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jsha/go/ocsp/helper"
+)
+
+// historyEntry is one line of the history file: the check's Record plus a
+// hash of the raw response, which tells identical responses apart from ones
+// that merely have the same fields.
+type historyEntry struct {
+	helper.Record
+	ResponseSHA256 string `json:"response_sha256,omitempty"`
+}
+
+// historyStore appends every check to a JSON Lines file and drops entries
+// older than the retention period.
+type historyStore struct {
+	path      string
+	retention time.Duration
+
+	mu   sync.Mutex
+	file *os.File
+}
+
+func openHistory(path string, retention time.Duration) (*historyStore, error) {
+	h := &historyStore{path: path, retention: retention}
+	if err := h.prune(); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// add records the outcome of checking f. Errors writing the history are
+// logged; they should not stop monitoring.
+func (h *historyStore) add(f string, result *helper.Result, err error) {
+	var entry historyEntry
+	if result != nil {
+		entry.Record = result.Record(f, err)
+		if len(result.RawResponse) > 0 {
+			sum := sha256.Sum256(result.RawResponse)
+			entry.ResponseSHA256 = hex.EncodeToString(sum[:])
+		}
+	} else {
+		now := time.Now()
+		entry.Record = helper.Record{Name: f, Start: &now, Class: helper.ClassInput}
+		if err != nil {
+			entry.Error = err.Error()
+		}
+	}
+	line, jsonErr := json.Marshal(entry)
+	if jsonErr != nil {
+		fmt.Fprintf(os.Stderr, "encoding history for %s: %s\n", f, jsonErr)
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, writeErr := h.file.Write(append(line, '\n')); writeErr != nil {
+		fmt.Fprintf(os.Stderr, "writing history: %s\n", writeErr)
+	}
+}
+
+// prune rewrites the history file without the entries older than the
+// retention period. A retention of zero keeps everything.
+func (h *historyStore) prune() error {
+	if h.retention > 0 {
+		if err := h.rewrite(time.Now().Add(-h.retention)); err != nil {
+			return err
+		}
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.file != nil {
+		return nil
+	}
+	return h.reopen()
+}
+
+// rewrite writes the entries from cutoff onwards to a temporary file and
+// renames it over the history. Checks keep appending to the old file while
+// it is filtered; only copying what they added and the rename itself hold
+// h.mu.
+func (h *historyStore) rewrite(cutoff time.Time) error {
+	h.mu.Lock()
+	in, err := os.Open(h.path)
+	var size int64
+	if err == nil {
+		var info os.FileInfo
+		if info, err = in.Stat(); err == nil {
+			size = info.Size()
+		}
+	}
+	h.mu.Unlock()
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer in.Close()
+	tmp := h.path + ".tmp"
+	out, err := os.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("pruning %s: %s", h.path, err)
+	}
+	w := bufio.NewWriter(out)
+	err = scanHistory(io.LimitReader(in, size), func(entry historyEntry, line []byte) {
+		if entry.Start != nil && entry.Start.Before(cutoff) {
+			return
+		}
+		w.Write(line)
+		w.WriteByte('\n')
+	})
+	if err == nil {
+		err = w.Flush()
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if err == nil {
+		if _, err = in.Seek(size, io.SeekStart); err == nil {
+			_, err = io.Copy(out, in)
+		}
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp, h.path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		err = fmt.Errorf("pruning %s: %s", h.path, err)
+	}
+	// Reopen whether or not the rename succeeded, so that checks always
+	// append to the file at h.path.
+	if openErr := h.reopen(); err == nil {
+		err = openErr
+	}
+	return err
+}
+
+// reopen opens the history file for appending, replacing h.file. If that
+// fails, h.file is left as it was. h.mu must be held.
+func (h *historyStore) reopen() error {
+	file, err := os.OpenFile(h.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	if h.file != nil {
+		h.file.Close()
+	}
+	h.file = file
+	return nil
+}
+
+// pruneEvery prunes the history periodically, forever.
+func (h *historyStore) pruneEvery(d time.Duration) {
+	for range time.Tick(d) {
+		if err := h.prune(); err != nil {
+			fmt.Fprintf(os.Stderr, "%s\n", err)
+		}
+	}
+}
+
+// scanHistory calls fn with each entry in r and the line it was decoded
+// from. Lines that cannot be decoded, such as one cut short by a crash, are
+// skipped.
+func scanHistory(r io.Reader, fn func(entry historyEntry, line []byte)) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		var entry historyEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			continue
+		}
+		fn(entry, scanner.Bytes())
+	}
+	return scanner.Err()
+}
+
+// query implements the "query" subcommand, which prints the entries in a
+// history file that match its flags.
+func query(args []string) error {
+	fs := flag.NewFlagSet("query", flag.ExitOnError)
+	path := fs.String("history-file", "", "History file to read")
+	fileGlob := fs.String("file", "", "Only show checks of certificate files whose path or base name matches this glob")
+	serial := fs.String("serial", "", "Only show checks of this serial number (hex)")
+	class := fs.String("class", "", "Only show checks with this result class, or \"error\" for any failure")
+	since := fs.Duration("since", 0, "Only show checks from this long ago onwards")
+	asJSON := fs.Bool("json", false, "Print matching entries as JSON Lines instead of a table")
+	fs.Parse(args)
+	if *path == "" {
+		return fmt.Errorf("query requires -history-file")
+	}
+	var wantSerial string
+	if *serial != "" {
+		s, err := helper.ParseSerial(*serial, 16)
+		if err != nil {
+			return err
+		}
+		wantSerial = fmt.Sprintf("%036x", s)
+	}
+	var cutoff time.Time
+	if *since > 0 {
+		cutoff = time.Now().Add(-*since)
+	}
+
+	in, err := os.Open(*path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	w := bufio.NewWriter(os.Stdout)
+	defer w.Flush()
+	return scanHistory(in, func(entry historyEntry, line []byte) {
+		if *fileGlob != "" {
+			full, _ := filepath.Match(*fileGlob, entry.Name)
+			base, _ := filepath.Match(*fileGlob, filepath.Base(entry.Name))
+			if !full && !base {
+				return
+			}
+		}
+		if wantSerial != "" && entry.Serial != wantSerial {
+			return
+		}
+		if *class == "error" && entry.Class == helper.ClassOK ||
+			*class != "" && *class != "error" && entry.Class != *class {
+			return
+		}
+		if !cutoff.IsZero() && (entry.Start == nil || entry.Start.Before(cutoff)) {
+			return
+		}
+		if *asJSON {
+			w.Write(line)
+			w.WriteByte('\n')
+			return
+		}
+		var when string
+		if entry.Start != nil {
+			when = entry.Start.UTC().Format(time.RFC3339)
+		}
+		status := entry.Status
+		if status == "" {
+			status = "-"
+		}
+		fmt.Fprintf(w, "%s %s %s %s %s http=%d %.1fms", when, entry.Name, entry.Serial,
+			entry.Class, status, entry.HTTPStatus, entry.DurationMS)
+		if entry.ResponseSHA256 != "" {
+			fmt.Fprintf(w, " sha256=%s", entry.ResponseSHA256[:16])
+		}
+		if entry.Error != "" {
+			fmt.Fprintf(w, " error=%q", strings.TrimSpace(entry.Error))
+		}
+		fmt.Fprintf(w, "\n")
+	})
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jsha/go/ocsp/helper"
+)
+
+// historyNames returns the names of the entries in the history file.
+func historyNames(t *testing.T, path string) []string {
+	t.Helper()
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, line := range strings.Split(strings.TrimSpace(string(contents)), "\n") {
+		var entry historyEntry
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, entry.Name)
+	}
+	return names
+}
+
+func TestHistoryPrune(t *testing.T) {
+	dir, err := ioutil.TempDir("", "history")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "history.jsonl")
+	var lines []byte
+	for _, e := range []struct {
+		name string
+		age  time.Duration
+	}{{"old", 2 * time.Hour}, {"new", time.Minute}} {
+		start := time.Now().Add(-e.age)
+		line, err := json.Marshal(historyEntry{Record: helper.Record{Name: e.name, Start: &start}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		lines = append(append(lines, line...), '\n')
+	}
+	if err := ioutil.WriteFile(path, lines, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	h, err := openHistory(path, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.add("added", nil, nil)
+	if got := strings.Join(historyNames(t, path), ","); got != "new,added" {
+		t.Errorf("got entries %s, want new,added", got)
+	}
+
+	// A prune that can't write its temporary file fails, but checks are
+	// still recorded.
+	if err := os.Mkdir(path+".tmp", 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.prune(); err == nil {
+		t.Errorf("prune succeeded without a temporary file")
+	}
+	h.add("after", nil, nil)
+	if got := strings.Join(historyNames(t, path), ","); got != "new,added,after" {
+		t.Errorf("got entries %s, want new,added,after", got)
+	}
+}
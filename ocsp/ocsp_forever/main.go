@@ -1,12 +1,13 @@
 package main
 
 import (
+	"bytes"
 	"flag"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
-	"path/filepath"
+	"sync"
 	"time"
 
 	"github.com/jsha/go/ocsp/helper"
@@ -15,7 +16,48 @@ import (
 )
 
 var listenAddress = flag.String("listen", ":8080", "Port to listen on")
-var interval = flag.String("interval", "1m", "Time to sleep between fetches")
+var interval = flag.String("interval", "1m", "How often to check each certificate, unless its pattern is given as glob@interval")
+var parallel = flag.Int("parallel", 8, "Maximum number of certificates to check at once")
+var jitter = flag.Float64("jitter", 0.1, "Randomly vary each interval by up to this fraction of itself, less than 1")
+var rescan = flag.Duration("rescan", time.Minute, "How often to re-evaluate the glob patterns for new and removed files")
+var history = flag.Int("history", 20, "Number of recent checks per certificate to show on the status page")
+var historyFile = flag.String("history-file", "", "File to which to append a JSON line for every check, for the query subcommand")
+var historyRetention = flag.Duration("history-retention", 30*24*time.Hour, "Drop history entries older than this (0 keeps everything)")
+var webhooks urlList
+var alertMaxAge = flag.Duration("alert-max-age", 0, "Alert when a response's thisUpdate is older than this (0 disables)")
+var alertNextUpdate = flag.Duration("alert-next-update", 0, "Alert when a response's nextUpdate is closer than this (0 disables)")
+var alertErrors = flag.Int("alert-errors", 0, "Alert after this many consecutive errors for a certificate (0 disables)")
+var alertRepeat = flag.Duration("alert-repeat", 24*time.Hour, "Resend alerts for conditions that are still true after this long (0 sends them once)")
+
+func init() {
+	flag.Var(&webhooks, "webhook", "URL to POST alerts to as JSON; may be given more than once")
+}
+
+// board backs the status page, alerts sends webhook notifications,
+// updates follows how often responders publish and store, if non-nil,
+// keeps the history of checks.
+var (
+	board   *statusBoard
+	alerts  *alerter
+	updates = newCadence()
+	store   *historyStore
+)
+var options = helper.RegisterFlags(flag.CommandLine)
+
+// certLabelNames label the per-certificate gauges. To keep cardinality
+// bounded, each file has one set of series at a time: when its certificate
+// is replaced or moves to another responder, the old series are deleted.
+var certLabelNames = []string{"file", "serial", "responder"}
+
+var (
+	certLabelsMu sync.Mutex
+	certLabels   = make(map[string]prom.Labels)
+	// responderSerials holds the serial of the delegated responder
+	// certificate that last signed each file's response. Many files share
+	// a responder, so its responder_cert_expiry_seconds series is deleted
+	// only once none of them uses it.
+	responderSerials = make(map[string]string)
+)
 
 var (
 	response_count = prom.NewCounterVec(prom.CounterOpts{
@@ -24,8 +66,8 @@ var (
 	}, nil)
 	errors_count = prom.NewCounterVec(prom.CounterOpts{
 		Name: "errors",
-		Help: "errored responses",
-	}, nil)
+		Help: "errored responses, by error class and responder",
+	}, []string{"class", "responder"})
 	request_time_seconds_hist = prom.NewHistogram(prom.HistogramOpts{
 		Name: "request_time_seconds",
 		Help: "time a request takes",
@@ -40,6 +82,71 @@ var (
 		Buckets: []float64{24 * time.Hour.Seconds(), 48 * time.Hour.Seconds(),
 			72 * time.Hour.Seconds(), 96 * time.Hour.Seconds(), 120 * time.Hour.Seconds()},
 	})
+	violations_count = prom.NewCounterVec(prom.CounterOpts{
+		Name: "violations",
+		Help: "policy violations and lint findings, by ID and severity",
+	}, []string{"id", "severity"})
+	responder_cert_expiry_seconds = prom.NewGaugeVec(prom.GaugeOpts{
+		Name: "responder_cert_expiry_seconds",
+		Help: "time until delegated responder certificates expire",
+	}, []string{"serial"})
+	http_phase_seconds = prom.NewHistogramVec(prom.HistogramOpts{
+		Name: "http_phase_seconds",
+		Help: "time spent in each phase of the AIA and OCSP HTTP requests",
+	}, []string{"fetch", "phase"})
+	cert_status = prom.NewGaugeVec(prom.GaugeOpts{
+		Name: "cert_status",
+		Help: "CertStatus of the last response for each certificate (0=good, 1=revoked, 2=unknown)",
+	}, certLabelNames)
+	cert_next_update_seconds = prom.NewGaugeVec(prom.GaugeOpts{
+		Name: "cert_next_update_seconds",
+		Help: "time until the nextUpdate of the last response for each certificate",
+	}, certLabelNames)
+	cert_response_age_seconds = prom.NewGaugeVec(prom.GaugeOpts{
+		Name: "cert_response_age_seconds",
+		Help: "age of the last response for each certificate, from its thisUpdate",
+	}, certLabelNames)
+	cert_last_success_timestamp_seconds = prom.NewGaugeVec(prom.GaugeOpts{
+		Name: "cert_last_success_timestamp_seconds",
+		Help: "Unix time of the last check without errors for each certificate",
+	}, certLabelNames)
+	monitored_files = prom.NewGauge(prom.GaugeOpts{
+		Name: "monitored_files",
+		Help: "number of certificate files matched by the glob patterns",
+	})
+	schedule_lag_seconds = prom.NewHistogram(prom.HistogramOpts{
+		Name:    "schedule_lag_seconds",
+		Help:    "how late checks started relative to when they were due",
+		Buckets: []float64{1, 2, 5, 10, 30, 60, 300, 900},
+	})
+	schedule_max_lag_seconds = prom.NewGauge(prom.GaugeOpts{
+		Name: "schedule_max_lag_seconds",
+		Help: "how overdue the oldest check waiting for a free slot is",
+	})
+	response_update_interval_seconds = prom.NewHistogramVec(prom.HistogramOpts{
+		Name: "response_update_interval_seconds",
+		Help: "time between successive responses seen for a certificate, by which field advanced",
+		Buckets: []float64{time.Hour.Seconds(), 2 * time.Hour.Seconds(), 4 * time.Hour.Seconds(),
+			8 * time.Hour.Seconds(), 12 * time.Hour.Seconds(), 24 * time.Hour.Seconds(),
+			48 * time.Hour.Seconds(), 72 * time.Hour.Seconds(), 96 * time.Hour.Seconds(),
+			120 * time.Hour.Seconds(), 168 * time.Hour.Seconds()},
+	}, []string{"field"})
+	response_updates = prom.NewCounterVec(prom.CounterOpts{
+		Name: "response_updates",
+		Help: "new responses seen, by responder",
+	}, []string{"responder"})
+	response_regressions = prom.NewCounterVec(prom.CounterOpts{
+		Name: "response_regressions",
+		Help: "responses older than one already seen for the same certificate, by field and responder",
+	}, []string{"field", "responder"})
+	webhook_alerts = prom.NewCounterVec(prom.CounterOpts{
+		Name: "webhook_alerts",
+		Help: "alerts delivered to webhooks, by kind and state",
+	}, []string{"kind", "state"})
+	webhook_errors = prom.NewCounterVec(prom.CounterOpts{
+		Name: "webhook_errors",
+		Help: "alerts that could not be delivered to a webhook, by kind",
+	}, []string{"kind"})
 	response_age_seconds_summary = prom.NewSummary(prom.SummaryOpts{
 		Name:       "response_age_seconds_summary",
 		Help:       "how old OCSP responses were",
@@ -49,47 +156,245 @@ var (
 
 func init() {
 	prom.MustRegister(response_count)
+	prom.MustRegister(errors_count)
+	prom.MustRegister(cert_status)
+	prom.MustRegister(cert_next_update_seconds)
+	prom.MustRegister(cert_response_age_seconds)
+	prom.MustRegister(cert_last_success_timestamp_seconds)
 	prom.MustRegister(request_time_seconds_hist)
 	prom.MustRegister(request_time_seconds_summary)
 	prom.MustRegister(response_age_seconds)
 	prom.MustRegister(response_age_seconds_summary)
+	prom.MustRegister(violations_count)
+	prom.MustRegister(responder_cert_expiry_seconds)
+	prom.MustRegister(http_phase_seconds)
+	prom.MustRegister(monitored_files)
+	prom.MustRegister(schedule_lag_seconds)
+	prom.MustRegister(schedule_max_lag_seconds)
+	prom.MustRegister(response_update_interval_seconds)
+	prom.MustRegister(response_updates)
+	prom.MustRegister(response_regressions)
+	prom.MustRegister(webhook_alerts)
+	prom.MustRegister(webhook_errors)
 }
 
-func do(f string) {
-	start := time.Now()
-	resp, err := helper.Req(f)
+// outputMu keeps the output of concurrent checks from interleaving.
+var outputMu sync.Mutex
+
+// checkFile checks f and prints the outcome.
+func checkFile(checker *helper.Checker, f string) (*helper.Result, error) {
+	result, err := checker.Req(f)
+	var buf bytes.Buffer
+	if result != nil {
+		result.Print(&buf)
+	}
+	if err == nil {
+		err = result.Err()
+	}
+	outputMu.Lock()
+	os.Stdout.Write(buf.Bytes())
 	if err != nil {
-		errors_count.With(prom.Labels{}).Inc()
 		fmt.Fprintf(os.Stderr, "error for %s: %s\n", f, err)
 	}
-	latency := time.Since(start)
+	outputMu.Unlock()
+	return result, err
+}
+
+// record updates the status page, alerts, history and metrics with the
+// outcome of a check of f.
+func record(f string, result *helper.Result, err error) {
+	board.record(f, result, err)
+	alerts.observe(f, result, err)
+	if store != nil {
+		store.add(f, result, err)
+	}
+	if result == nil {
+		errors_count.With(prom.Labels{"class": helper.ClassInput, "responder": ""}).Inc()
+		return
+	}
+	if err != nil {
+		errors_count.With(prom.Labels{"class": result.Class(), "responder": result.Responder()}).Inc()
+	}
+	observeCert(f, result, err)
+	updates.observe(f, result)
+	for _, v := range result.Violations {
+		violations_count.With(prom.Labels{"id": v.ID, "severity": v.Severity.String()}).Inc()
+	}
+	observeResponder(f, result)
+	if result.IssuerTiming != nil {
+		observePhases("aia", result.IssuerTiming)
+	}
+	if result.FetchTiming.Total > 0 {
+		observePhases("ocsp", &result.FetchTiming)
+	}
+	latency := result.Duration
 	request_time_seconds_hist.Observe(latency.Seconds())
 	response_count.With(prom.Labels{}).Inc()
 	request_time_seconds_summary.Observe(latency.Seconds())
-	if resp != nil {
+	if resp := result.Response; resp != nil {
 		response_age_seconds.Observe(time.Since(resp.ThisUpdate).Seconds())
 		response_age_seconds_summary.Observe(time.Since(resp.ThisUpdate).Seconds())
 	}
 }
 
+// observeCert updates the per-certificate gauges for the certificate in f.
+// A check that never reached a responder, for instance because the issuer
+// could not be fetched, leaves them as they were: replacing their labels
+// would delete cert_last_success_timestamp_seconds, which alerts on the
+// outage watch.
+func observeCert(f string, result *helper.Result, err error) {
+	if result.Serial == nil || result.Responder() == "" {
+		return
+	}
+	labels := prom.Labels{
+		"file":      f,
+		"serial":    fmt.Sprintf("%x", result.Serial),
+		"responder": result.Responder(),
+	}
+	certLabelsMu.Lock()
+	if old, ok := certLabels[f]; ok && !sameLabels(old, labels) {
+		cert_status.Delete(old)
+		cert_next_update_seconds.Delete(old)
+		cert_response_age_seconds.Delete(old)
+		cert_last_success_timestamp_seconds.Delete(old)
+	}
+	certLabels[f] = labels
+	certLabelsMu.Unlock()
+
+	if resp := result.Response; resp != nil {
+		cert_status.With(labels).Set(float64(resp.Status))
+		cert_response_age_seconds.With(labels).Set(time.Since(resp.ThisUpdate).Seconds())
+		if !resp.NextUpdate.IsZero() {
+			cert_next_update_seconds.With(labels).Set(time.Until(resp.NextUpdate).Seconds())
+		}
+	}
+	if err == nil {
+		cert_last_success_timestamp_seconds.With(labels).Set(float64(time.Now().Unix()))
+	}
+}
+
+// observeResponder updates the expiry gauge for the delegated responder
+// certificate that signed f's response, if any, deleting the series of the
+// one that signed it before if no other file still uses it. Checks without
+// a response leave things as they were.
+func observeResponder(f string, result *helper.Result) {
+	if result.Response == nil {
+		return
+	}
+	serial := ""
+	if d := result.Delegated; d != nil {
+		serial = fmt.Sprintf("%x", d.Cert.SerialNumber)
+	}
+	certLabelsMu.Lock()
+	defer certLabelsMu.Unlock()
+	if old, ok := responderSerials[f]; ok && old != serial {
+		delete(responderSerials, f)
+		releaseResponder(old)
+	}
+	if serial != "" {
+		responderSerials[f] = serial
+		responder_cert_expiry_seconds.With(prom.Labels{"serial": serial}).Set(result.Delegated.ExpiresIn.Seconds())
+	}
+}
+
+// releaseResponder deletes the expiry series for the responder certificate
+// with serial unless some file still uses it. certLabelsMu must be held.
+func releaseResponder(serial string) {
+	for _, s := range responderSerials {
+		if s == serial {
+			return
+		}
+	}
+	responder_cert_expiry_seconds.DeleteLabelValues(serial)
+}
+
+// forgetCert deletes the per-certificate series for f, which is no longer
+// monitored, and its responder's expiry series if no other file uses it.
+func forgetCert(f string) {
+	certLabelsMu.Lock()
+	defer certLabelsMu.Unlock()
+	if old, ok := certLabels[f]; ok {
+		cert_status.Delete(old)
+		cert_next_update_seconds.Delete(old)
+		cert_response_age_seconds.Delete(old)
+		cert_last_success_timestamp_seconds.Delete(old)
+		delete(certLabels, f)
+	}
+	if serial, ok := responderSerials[f]; ok {
+		delete(responderSerials, f)
+		releaseResponder(serial)
+	}
+}
+
+func sameLabels(a, b prom.Labels) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if b[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// observePhases records the phases of an HTTP request. Phases that did not
+// happen, like DNS on a reused connection, are left out rather than counted
+// as zero.
+func observePhases(fetch string, timing *helper.Timing) {
+	for _, p := range timing.Phases() {
+		if p.Duration > 0 {
+			http_phase_seconds.With(prom.Labels{"fetch": fetch, "phase": p.Name}).Observe(p.Duration.Seconds())
+		}
+	}
+}
+
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "query" {
+		if err := query(os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
 	flag.Parse()
-	sleepTime, err := time.ParseDuration(*interval)
+	if *history < 0 {
+		log.Fatalf("-history must not be negative, not %d", *history)
+	}
+	if *parallel < 1 {
+		log.Fatalf("-parallel must be at least 1, not %d", *parallel)
+	}
+	if *jitter < 0 || *jitter >= 1 {
+		log.Fatalf("-jitter must be at least 0 and less than 1, not %g", *jitter)
+	}
+	defaultInterval, err := time.ParseDuration(*interval)
 	if err != nil {
 		log.Fatal(err)
 	}
-	http.Handle("/metrics", promhttp.Handler())
-	go http.ListenAndServe(*listenAddress, nil)
-	for {
-		for _, pattern := range flag.Args() {
-			files, err := filepath.Glob(pattern)
-			if err != nil {
-				log.Fatal(err)
-			}
-			for _, f := range files {
-				do(f)
-				time.Sleep(sleepTime)
-			}
+	var patterns []pattern
+	for _, arg := range flag.Args() {
+		p, err := parsePattern(arg, defaultInterval)
+		if err != nil {
+			log.Fatalf("parsing %q: %s", arg, err)
 		}
+		patterns = append(patterns, p)
+	}
+	opts, err := options()
+	if err != nil {
+		log.Fatal(err)
 	}
+	checker := helper.New(opts)
+	board = newStatusBoard(*history)
+	if *historyFile != "" {
+		store, err = openHistory(*historyFile, *historyRetention)
+		if err != nil {
+			log.Fatal(err)
+		}
+		go store.pruneEvery(time.Hour)
+	}
+	alerts = newAlerter(webhooks, *alertMaxAge, *alertNextUpdate, *alertErrors, *alertRepeat)
+	http.Handle("/metrics", promhttp.Handler())
+	http.HandleFunc("/status.json", board.serveJSON)
+	http.HandleFunc("/", board.serveHTML)
+	go http.ListenAndServe(*listenAddress, nil)
+	newScheduler(checker, patterns, *parallel, *jitter).loop(*rescan)
 }
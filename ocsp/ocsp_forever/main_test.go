@@ -0,0 +1,57 @@
+package main
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/jsha/go/ocsp/helper"
+	prom "github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"golang.org/x/crypto/ocsp"
+)
+
+func TestObserveCertKeepsSeriesWithoutResponder(t *testing.T) {
+	const f = "test.pem"
+	defer forgetCert(f)
+	good := &helper.Result{
+		Serial: big.NewInt(0x1234),
+		URL:    "http://ocsp.example.com/",
+		Response: &ocsp.Response{
+			Status:     ocsp.Good,
+			ThisUpdate: time.Now().Add(-time.Hour),
+			NextUpdate: time.Now().Add(time.Hour),
+		},
+	}
+	observeCert(f, good, nil)
+	labels := prom.Labels{"file": f, "serial": "1234", "responder": "ocsp.example.com"}
+	success := testutil.ToFloat64(cert_last_success_timestamp_seconds.With(labels))
+	if success == 0 {
+		t.Fatal("no last success recorded")
+	}
+
+	// The issuer can't be fetched, so no responder is contacted.
+	observeCert(f, &helper.Result{Serial: good.Serial}, errors.New("fetching issuer: connection refused"))
+	if n := testutil.CollectAndCount(cert_last_success_timestamp_seconds); n != 1 {
+		t.Errorf("%d last success series, want 1", n)
+	}
+	if got := testutil.ToFloat64(cert_last_success_timestamp_seconds.With(labels)); got != success {
+		t.Errorf("last success changed from %v to %v", success, got)
+	}
+	if n := testutil.CollectAndCount(cert_status); n != 1 {
+		t.Errorf("%d status series, want 1", n)
+	}
+
+	// A later answer from another responder replaces the series.
+	moved := *good
+	moved.URL = "http://ocsp2.example.com/"
+	observeCert(f, &moved, nil)
+	if n := testutil.CollectAndCount(cert_last_success_timestamp_seconds); n != 1 {
+		t.Errorf("%d last success series after moving, want 1", n)
+	}
+	labels["responder"] = "ocsp2.example.com"
+	if got := testutil.ToFloat64(cert_last_success_timestamp_seconds.With(labels)); got == 0 {
+		t.Errorf("no last success for the new responder")
+	}
+}
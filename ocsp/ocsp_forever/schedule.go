@@ -0,0 +1,195 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math/rand"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jsha/go/ocsp/helper"
+)
+
+// pattern is a glob of certificate files to monitor, and how often to check
+// each of them.
+type pattern struct {
+	glob     string
+	interval time.Duration
+}
+
+// parsePattern parses a command line argument of the form "glob" or
+// "glob@interval". A suffix after the last "@" that isn't a duration is part
+// of the glob, so file names may contain "@".
+func parsePattern(arg string, defaultInterval time.Duration) (pattern, error) {
+	p := pattern{arg, defaultInterval}
+	if i := strings.LastIndex(arg, "@"); i >= 0 {
+		if interval, err := time.ParseDuration(arg[i+1:]); err == nil {
+			p = pattern{arg[:i], interval}
+		}
+	}
+	if p.interval <= 0 {
+		return pattern{}, fmt.Errorf("interval must be positive, not %s", p.interval)
+	}
+	return p, nil
+}
+
+// entry is a single monitored file.
+type entry struct {
+	file     string
+	interval time.Duration
+	due      time.Time
+	running  bool
+}
+
+// scheduler checks each monitored file on its own interval, running at most
+// cap(sem) checks at once. Each interval is randomly lengthened or shortened
+// by up to jitter times itself, so that files added together drift apart
+// instead of hitting their responders in bursts.
+type scheduler struct {
+	checker  *helper.Checker
+	patterns []pattern
+	jitter   float64
+	sem      chan struct{}
+
+	mu      sync.Mutex
+	entries map[string]*entry
+}
+
+// newScheduler returns a scheduler for patterns. parallel must be at least 1
+// and jitter in [0, 1), so that every interval stays positive.
+func newScheduler(checker *helper.Checker, patterns []pattern, parallel int, jitter float64) *scheduler {
+	return &scheduler{
+		checker:  checker,
+		patterns: patterns,
+		jitter:   jitter,
+		sem:      make(chan struct{}, parallel),
+		entries:  make(map[string]*entry),
+	}
+}
+
+// spread returns d adjusted by a random amount of up to s.jitter times d.
+func (s *scheduler) spread(d time.Duration) time.Duration {
+	return d + time.Duration((rand.Float64()*2-1)*s.jitter*float64(d))
+}
+
+// rescan evaluates the glob patterns again, scheduling new files soon and
+// forgetting files that have gone away. A file matched by several patterns
+// is checked on the shortest of their intervals.
+func (s *scheduler) rescan(now time.Time) {
+	found := make(map[string]time.Duration)
+	for _, p := range s.patterns {
+		files, err := filepath.Glob(p.glob)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, f := range files {
+			if d, ok := found[f]; !ok || p.interval < d {
+				found[f] = p.interval
+			}
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for f, interval := range found {
+		if e, ok := s.entries[f]; ok {
+			e.interval = interval
+			continue
+		}
+		s.entries[f] = &entry{
+			file:     f,
+			interval: interval,
+			due:      now.Add(time.Duration(rand.Float64() * s.jitter * float64(interval))),
+		}
+	}
+	for f, e := range s.entries {
+		if _, ok := found[f]; !ok {
+			delete(s.entries, f)
+			// A running check forgets f itself once it is done, so
+			// that its results don't bring f back.
+			if !e.running {
+				forget(f)
+			}
+		}
+	}
+	monitored_files.Set(float64(len(s.entries)))
+}
+
+// dispatch starts checks for due files, oldest first, until the concurrency
+// limit is reached. Files still waiting count towards the lag.
+func (s *scheduler) dispatch(now time.Time) {
+	s.mu.Lock()
+	var due []*entry
+	for _, e := range s.entries {
+		if !e.running && !e.due.After(now) {
+			due = append(due, e)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool { return due[i].due.Before(due[j].due) })
+	var waiting time.Duration
+	for _, e := range due {
+		select {
+		case s.sem <- struct{}{}:
+		default:
+			if lag := now.Sub(e.due); lag > waiting {
+				waiting = lag
+			}
+			continue
+		}
+		e.running = true
+		schedule_lag_seconds.Observe(now.Sub(e.due).Seconds())
+		go s.run(e)
+	}
+	s.mu.Unlock()
+	schedule_max_lag_seconds.Set(waiting.Seconds())
+}
+
+// run checks e's file and records the result, unless the file stopped
+// being monitored in the meantime.
+func (s *scheduler) run(e *entry) {
+	result, err := checkFile(s.checker, e.file)
+	<-s.sem
+	if s.scheduled(e) {
+		record(e.file, result, err)
+	}
+	s.mu.Lock()
+	e.running = false
+	e.due = time.Now().Add(s.spread(e.interval))
+	_, ok := s.entries[e.file]
+	s.mu.Unlock()
+	if !ok {
+		forget(e.file)
+	}
+}
+
+// scheduled reports whether e is still monitored.
+func (s *scheduler) scheduled(e *entry) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.entries[e.file] == e
+}
+
+// forget drops the state kept for f, which is no longer monitored.
+func forget(f string) {
+	forgetCert(f)
+	board.forget(f)
+	alerts.forget(f)
+	updates.forget(f)
+}
+
+// loop runs the scheduler forever, re-evaluating the patterns every
+// rescanInterval.
+func (s *scheduler) loop(rescanInterval time.Duration) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	var nextRescan time.Time
+	for now := time.Now(); ; now = <-ticker.C {
+		if !now.Before(nextRescan) {
+			s.rescan(now)
+			nextRescan = now.Add(rescanInterval)
+		}
+		s.dispatch(now)
+	}
+}
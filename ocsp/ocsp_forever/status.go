@@ -0,0 +1,176 @@
+package main
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jsha/go/ocsp/helper"
+)
+
+// check is a compact record of one past check, for the status history.
+type check struct {
+	Time       time.Time `json:"time"`
+	Class      string    `json:"class"`
+	Status     string    `json:"status,omitempty"`
+	HTTPStatus int       `json:"http_status,omitempty"`
+	DurationMS float64   `json:"duration_ms"`
+}
+
+// certState is what the status page shows for one monitored file.
+type certState struct {
+	File        string        `json:"file"`
+	Last        helper.Record `json:"last"`
+	LastSuccess *time.Time    `json:"last_success,omitempty"`
+	LastError   string        `json:"last_error,omitempty"`
+	LastErrorAt *time.Time    `json:"last_error_at,omitempty"`
+	// History holds the most recent checks, newest first.
+	History []check `json:"history"`
+}
+
+// statusBoard keeps the latest state of every monitored file for the status
+// page and /status.json.
+type statusBoard struct {
+	historyLen int
+
+	mu    sync.Mutex
+	certs map[string]*certState
+}
+
+func newStatusBoard(historyLen int) *statusBoard {
+	return &statusBoard{
+		historyLen: historyLen,
+		certs:      make(map[string]*certState),
+	}
+}
+
+// record notes the outcome of checking f.
+func (b *statusBoard) record(f string, result *helper.Result, err error) {
+	var rec helper.Record
+	if result != nil {
+		rec = result.Record(f, err)
+	} else {
+		rec = helper.Record{Name: f, Class: helper.ClassInput}
+		if err != nil {
+			rec.Error = err.Error()
+		}
+	}
+	now := time.Now()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	state, ok := b.certs[f]
+	if !ok {
+		state = &certState{File: f}
+		b.certs[f] = state
+	}
+	state.Last = rec
+	if err != nil {
+		state.LastError = err.Error()
+		state.LastErrorAt = &now
+	} else {
+		state.LastSuccess = &now
+	}
+	state.History = append([]check{{
+		Time:       now,
+		Class:      rec.Class,
+		Status:     rec.Status,
+		HTTPStatus: rec.HTTPStatus,
+		DurationMS: rec.DurationMS,
+	}}, state.History...)
+	if len(state.History) > b.historyLen {
+		state.History = state.History[:b.historyLen]
+	}
+}
+
+// forget drops f, which is no longer monitored.
+func (b *statusBoard) forget(f string) {
+	b.mu.Lock()
+	delete(b.certs, f)
+	b.mu.Unlock()
+}
+
+// snapshot returns a copy of every file's state, sorted by file name.
+func (b *statusBoard) snapshot() []certState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	states := make([]certState, 0, len(b.certs))
+	for _, state := range b.certs {
+		s := *state
+		s.History = append([]check(nil), state.History...)
+		states = append(states, s)
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i].File < states[j].File })
+	return states
+}
+
+func (b *statusBoard) serveJSON(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(b.snapshot())
+}
+
+func (b *statusBoard) serveHTML(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	statusTemplate.Execute(w, struct {
+		Now   time.Time
+		Certs []certState
+	}{time.Now(), b.snapshot()})
+}
+
+var statusTemplate = template.Must(template.New("status").Funcs(template.FuncMap{
+	"ago": func(t *time.Time) string {
+		if t == nil {
+			return "never"
+		}
+		return time.Since(*t).Truncate(time.Second).String() + " ago"
+	},
+	"when": func(t *time.Time) string {
+		if t == nil {
+			return ""
+		}
+		return t.UTC().Format(time.RFC3339)
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<title>OCSP status</title>
+<style>
+body { font-family: sans-serif; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: left; vertical-align: top; }
+.ok { background: #dfd; }
+.bad { background: #fdd; }
+.history span { display: inline-block; width: 10px; height: 10px; margin-right: 1px; }
+</style>
+</head>
+<body>
+<h1>OCSP status</h1>
+<p>{{len .Certs}} certificates, as of {{.Now.UTC.Format "2006-01-02 15:04:05 MST"}}. Also available as <a href="/status.json">JSON</a>.</p>
+<table>
+<tr><th>File</th><th>Serial</th><th>Responder</th><th>Result</th><th>Status</th><th>ThisUpdate</th><th>NextUpdate</th><th>Last success</th><th>Last error</th><th>History</th></tr>
+{{range .Certs}}
+<tr class="{{if eq .Last.Class "ok"}}ok{{else}}bad{{end}}">
+<td>{{.File}}</td>
+<td><code>{{.Last.Serial}}</code></td>
+<td>{{.Last.Server}}</td>
+<td>{{.Last.Class}}</td>
+<td>{{.Last.Status}}</td>
+<td>{{when .Last.ThisUpdate}}</td>
+<td>{{when .Last.NextUpdate}}</td>
+<td>{{ago .LastSuccess}}</td>
+<td>{{if .LastErrorAt}}{{ago .LastErrorAt}}: {{.LastError}}{{end}}</td>
+<td class="history">{{range .History}}<span class="{{if eq .Class "ok"}}ok{{else}}bad{{end}}" title="{{.Time.UTC.Format "15:04:05"}} {{.Class}}"></span>{{end}}</td>
+</tr>
+{{end}}
+</table>
+</body>
+</html>
+`))
@@ -0,0 +1,414 @@
+// ocsp_load replays OCSP requests for a corpus of certificates against a
+// responder, at a fixed rate or with a fixed number of concurrent clients,
+// and reports latency percentiles, throughput, and the distribution of
+// HTTP status codes, Cache-Control headers and validation failures.
+//
+// The corpus is given as certificate files (or directories of them), or
+// with -serials as a file of hex serial numbers issued by -issuer.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/x509"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"math/big"
+	"math/rand"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jsha/go/ocsp/helper"
+	"golang.org/x/crypto/ocsp"
+)
+
+var issuerFile = flag.String("issuer", "", "Issuer certificate, required with -serials; otherwise taken from each file's chain or via AIA")
+var serials = flag.String("serials", "", "File of hex serial numbers, one per line, to use instead of certificate files")
+var responderURL = flag.String("url", "", "Responder URL (default: the one in each certificate; required with -serials)")
+var hashName = flag.String("hash", "sha1", "Hash to use for CertIDs")
+var rate = flag.Float64("rate", 0, "Requests per second to send; if zero, send as fast as -concurrency allows")
+var concurrency = flag.Int("concurrency", 10, "Number of requests in flight at once (the limit, with -rate)")
+var duration = flag.Duration("duration", 30*time.Second, "How long to run")
+var maxRequests = flag.Int("requests", 0, "Stop after this many requests (0 for no limit)")
+var postFraction = flag.Float64("post-fraction", 0, "Fraction of requests to send with POST rather than GET")
+var timeout = flag.Duration("timeout", 5*time.Second, "Timeout for each request")
+
+// target is one CertID from the corpus, with its request prepared in both
+// forms.
+type target struct {
+	serial *big.Int
+	issuer *x509.Certificate
+	server string
+	der    []byte
+	getURL string
+}
+
+// sample is the outcome of one request.
+type sample struct {
+	latency      time.Duration
+	method       string
+	httpStatus   int
+	cacheControl string
+	err          error
+	invalid      bool
+}
+
+func main() {
+	flag.Parse()
+	if *concurrency < 1 {
+		log.Fatalf("-concurrency must be at least 1, not %d", *concurrency)
+	}
+	if *rate > 0 && time.Duration(float64(time.Second) / *rate) <= 0 {
+		log.Fatalf("-rate %g is too high, the most is %d per second", *rate, time.Second)
+	}
+	hash, err := helper.ParseHash(*hashName)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var issuer *x509.Certificate
+	if *issuerFile != "" {
+		certs, err := helper.ReadCertificates(*issuerFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		issuer = certs[0]
+	}
+	var targets []target
+	if *serials != "" {
+		targets, err = serialTargets(*serials, issuer)
+	} else {
+		targets, err = fileTargets(flag.Args(), issuer)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(targets) == 0 {
+		log.Fatal("no certificates to request")
+	}
+	for i := range targets {
+		t := &targets[i]
+		t.der, err = helper.CreateRequest(t.serial, t.issuer, hash, nil)
+		if err != nil {
+			log.Fatal(err)
+		}
+		t.getURL = helper.GetURL(t.server, t.der)
+	}
+	log.Printf("loaded %d CertIDs", len(targets))
+
+	client := &http.Client{
+		Timeout: *timeout,
+		Transport: &http.Transport{
+			Proxy:               http.ProxyFromEnvironment,
+			MaxIdleConnsPerHost: *concurrency,
+		},
+	}
+	start := time.Now()
+	samples, skipped := run(client, targets)
+	report(os.Stdout, samples, skipped, time.Since(start))
+}
+
+// fileTargets reads the certificates named by args, descending into
+// directories.
+func fileTargets(args []string, issuer *x509.Certificate) ([]target, error) {
+	var opts helper.Options
+	if issuer != nil {
+		opts.Issuers = []*x509.Certificate{issuer}
+	}
+	checker := helper.New(opts)
+	var targets []target
+	for _, arg := range args {
+		err := filepath.Walk(arg, func(path string, info os.FileInfo, err error) error {
+			if err != nil || info.IsDir() {
+				return err
+			}
+			chain, err := helper.ReadCertificates(path)
+			if err != nil {
+				log.Printf("skipping %s: %s", path, err)
+				return nil
+			}
+			certIssuer, err := checker.Issuer(chain)
+			if err != nil {
+				log.Printf("skipping %s: %s", path, err)
+				return nil
+			}
+			server := *responderURL
+			if server == "" && len(chain[0].OCSPServer) > 0 {
+				server = chain[0].OCSPServer[0]
+			}
+			if server == "" {
+				log.Printf("skipping %s: no OCSP server", path)
+				return nil
+			}
+			targets = append(targets, target{serial: chain[0].SerialNumber, issuer: certIssuer, server: server})
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return targets, nil
+}
+
+// serialTargets reads a file of hex serials issued by issuer.
+func serialTargets(fileName string, issuer *x509.Certificate) ([]target, error) {
+	if issuer == nil || *responderURL == "" {
+		return nil, fmt.Errorf("-serials requires -issuer and -url")
+	}
+	f, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var targets []target
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		serial, err := helper.ParseSerial(line, 16)
+		if err != nil {
+			return nil, err
+		}
+		targets = append(targets, target{serial: serial, issuer: issuer, server: *responderURL})
+	}
+	return targets, scanner.Err()
+}
+
+// run sends requests for randomly chosen targets until -duration has passed
+// or -requests have been sent. With -rate, requests are started on a fixed
+// schedule, and those that would exceed -concurrency are skipped; run
+// returns how many were, and they don't count towards -requests. Otherwise
+// -concurrency workers send requests back to back.
+func run(client *http.Client, targets []target) ([]sample, int) {
+	var mu sync.Mutex
+	var samples []sample
+	var sent int
+	deadline := time.Now().Add(*duration)
+	// over reports whether the run is over; the caller must hold mu.
+	over := func() bool {
+		return time.Now().After(deadline) || *maxRequests > 0 && sent >= *maxRequests
+	}
+	// next reserves a request, returning false when the run is over.
+	next := func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		if over() {
+			return false
+		}
+		sent++
+		return true
+	}
+	do := func() {
+		s := send(client, targets[rand.Intn(len(targets))])
+		mu.Lock()
+		samples = append(samples, s)
+		mu.Unlock()
+	}
+
+	var wg sync.WaitGroup
+	if *rate <= 0 {
+		for i := 0; i < *concurrency; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for next() {
+					do()
+				}
+			}()
+		}
+		wg.Wait()
+		return samples, 0
+	}
+
+	sem := make(chan struct{}, *concurrency)
+	ticker := time.NewTicker(time.Duration(float64(time.Second) / *rate))
+	defer ticker.Stop()
+	skipped := 0
+ticks:
+	for range ticker.C {
+		select {
+		case sem <- struct{}{}:
+		default:
+			mu.Lock()
+			done := over()
+			mu.Unlock()
+			if done {
+				break ticks
+			}
+			skipped++
+			continue
+		}
+		if !next() {
+			break
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			do()
+			<-sem
+		}()
+	}
+	wg.Wait()
+	return samples, skipped
+}
+
+// send makes one request for t and validates the response.
+func send(client *http.Client, t target) sample {
+	s := sample{method: "GET"}
+	var req *http.Request
+	var err error
+	if rand.Float64() < *postFraction || len(t.getURL) > 255 {
+		s.method = "POST"
+		req, err = http.NewRequest("POST", t.server, bytes.NewReader(t.der))
+		if err == nil {
+			req.Header.Set("Content-Type", "application/ocsp-request")
+		}
+	} else {
+		req, err = http.NewRequest("GET", t.getURL, nil)
+	}
+	if err != nil {
+		s.err = err
+		return s
+	}
+	start := time.Now()
+	resp, err := client.Do(req)
+	if err != nil {
+		s.latency = time.Since(start)
+		s.err = err
+		return s
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	s.latency = time.Since(start)
+	s.httpStatus = resp.StatusCode
+	s.cacheControl = resp.Header.Get("Cache-Control")
+	if err != nil {
+		s.err = err
+		return s
+	}
+	if resp.StatusCode != 200 {
+		return s
+	}
+	parsed, err := ocsp.ParseResponseForCert(body, &x509.Certificate{SerialNumber: t.serial}, t.issuer)
+	if err != nil || !parsed.NextUpdate.IsZero() && parsed.NextUpdate.Before(time.Now()) {
+		s.invalid = true
+	}
+	return s
+}
+
+// report prints a summary of samples, collected over elapsed, and of the
+// skipped requests, to w.
+func report(w io.Writer, samples []sample, skipped int, elapsed time.Duration) {
+	if skipped > 0 {
+		fmt.Fprintf(w, "Skipped %d requests with %d already in flight\n", skipped, *concurrency)
+	}
+	if len(samples) == 0 {
+		fmt.Fprintf(w, "No requests completed\n")
+		return
+	}
+	var latencies []time.Duration
+	var errors, invalid, ok int
+	byStatus := make(map[string]int)
+	byMethod := make(map[string]int)
+	byCache := make(map[string]int)
+	for _, s := range samples {
+		latencies = append(latencies, s.latency)
+		byMethod[s.method]++
+		if s.err != nil {
+			errors++
+			byStatus["error"]++
+			continue
+		}
+		byStatus[fmt.Sprintf("%d", s.httpStatus)]++
+		byCache[normalizeCacheControl(s.cacheControl)]++
+		if s.httpStatus == 200 {
+			if s.invalid {
+				invalid++
+			} else {
+				ok++
+			}
+		}
+	}
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	var total time.Duration
+	for _, l := range latencies {
+		total += l
+	}
+	n := len(samples)
+	fmt.Fprintf(w, "Requests %d, errors %d\n", n, errors)
+	fmt.Fprintf(w, "Throughput %.1f req/s\n", float64(n)/elapsed.Seconds())
+	fmt.Fprintf(w, "Latency mean %s p50 %s p90 %s p99 %s max %s\n",
+		(total / time.Duration(n)).Round(time.Microsecond),
+		percentile(latencies, 0.50), percentile(latencies, 0.90),
+		percentile(latencies, 0.99), latencies[n-1].Round(time.Microsecond))
+	if ok+invalid > 0 {
+		fmt.Fprintf(w, "Validation failures %d of %d responses (%.2f%%)\n",
+			invalid, ok+invalid, 100*float64(invalid)/float64(ok+invalid))
+	}
+	printCounts(w, "Methods", byMethod)
+	printCounts(w, "HTTP status", byStatus)
+	printCounts(w, "Cache-Control", byCache)
+}
+
+// percentile returns the p'th percentile of sorted.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	i := int(p * float64(len(sorted)))
+	if i >= len(sorted) {
+		i = len(sorted) - 1
+	}
+	return sorted[i].Round(time.Microsecond)
+}
+
+// normalizeCacheControl groups Cache-Control values that differ only in
+// max-age, which counts down between requests, replacing it with its order
+// of magnitude.
+func normalizeCacheControl(value string) string {
+	if value == "" {
+		return "(none)"
+	}
+	var parts []string
+	for _, directive := range strings.Split(value, ",") {
+		directive = strings.ToLower(strings.TrimSpace(directive))
+		var seconds int
+		if _, err := fmt.Sscanf(directive, "max-age=%d", &seconds); err == nil {
+			switch {
+			case seconds <= 0:
+				directive = "max-age=0"
+			case seconds < 3600:
+				directive = "max-age<1h"
+			case seconds < 86400:
+				directive = "max-age<1d"
+			default:
+				directive = "max-age>=1d"
+			}
+		}
+		parts = append(parts, directive)
+	}
+	return strings.Join(parts, ", ")
+}
+
+func printCounts(w io.Writer, name string, counts map[string]int) {
+	var keys []string
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if counts[keys[i]] != counts[keys[j]] {
+			return counts[keys[i]] > counts[keys[j]]
+		}
+		return keys[i] < keys[j]
+	})
+	fmt.Fprintf(w, "%s:\n", name)
+	for _, k := range keys {
+		fmt.Fprintf(w, "  %8d %s\n", counts[k], k)
+	}
+}
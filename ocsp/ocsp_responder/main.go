@@ -0,0 +1,135 @@
+// ocsp_responder serves OCSP from a local test CA, for exercising the ocsp
+// commands without the internet. Unless -ca and -ca-key are given, it
+// creates a CA, and writes it to -dir along with -leaves leaf certificates
+// whose OCSP and AIA URLs point back at the responder.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/jsha/go/ocsp/helper"
+	"github.com/jsha/go/ocsp/responder"
+)
+
+var listenAddress = flag.String("listen", "127.0.0.1:8888", "Address to listen on")
+var baseURL = flag.String("base-url", "", "URL at which clients reach the responder, for generated certificates (default: http:// plus -listen)")
+var caFile = flag.String("ca", "", "CA certificate to answer for (default: create one)")
+var caKeyFile = flag.String("ca-key", "", "Private key of -ca")
+var dir = flag.String("dir", ".", "Directory in which to write generated certificates")
+var leaves = flag.Int("leaves", 3, "Number of leaf certificates to issue when creating a CA, with serials 1, 2, ...")
+var delegated = flag.Bool("delegated", false, "Sign responses with a delegated responder certificate instead of the CA key")
+var statusFile = flag.String("status", "", "File mapping hex serials to statuses; see package responder")
+var defaultStatus = flag.String("default-status", "good", "Status for serials not in -status: good, revoked or unknown")
+var validity = flag.Duration("validity", 0, "Time from thisUpdate to nextUpdate (default 96h)")
+var aiaPath = flag.String("aia-path", "/issuer", "Path at which to serve the CA certificate")
+var faults = flag.String("fault", "", "Comma-separated ways to misbehave: stale, wrong-signer, malformed, 5xx, slow, content-type")
+var delay = flag.Duration("delay", 10*time.Second, "How long -fault slow waits before answering")
+
+func main() {
+	flag.Parse()
+	ln, err := net.Listen("tcp", *listenAddress)
+	if err != nil {
+		log.Fatal(err)
+	}
+	base := *baseURL
+	if base == "" {
+		base = "http://" + ln.Addr().String()
+	}
+	base = strings.TrimSuffix(base, "/")
+
+	ca, err := loadCA(base)
+	if err != nil {
+		log.Fatal(err)
+	}
+	faultSet, err := responder.ParseFaults(*faults)
+	if err != nil {
+		log.Fatal(err)
+	}
+	status, err := responder.ParseStatus(*defaultStatus)
+	if err != nil {
+		log.Fatal(err)
+	}
+	r := &responder.Responder{
+		Issuer:        ca.Cert,
+		Signer:        ca.Key,
+		SignerCert:    ca.Cert,
+		DefaultStatus: status,
+		Validity:      *validity,
+		AIAPath:       *aiaPath,
+		Faults:        faultSet,
+		Delay:         *delay,
+	}
+	if *statusFile != "" {
+		r.Statuses, err = responder.OpenStatusFile(*statusFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	if *delegated {
+		cert, key, err := ca.Delegate("Test OCSP Responder")
+		if err != nil {
+			log.Fatal(err)
+		}
+		r.Signer, r.SignerCert = key, cert
+		if err := responder.WriteCertificate(filepath.Join(*dir, "responder.pem"), cert); err != nil {
+			log.Fatal(err)
+		}
+	}
+	log.Printf("serving OCSP for %s at %s/", ca.Cert.Subject, base)
+	log.Fatal(http.Serve(ln, r))
+}
+
+// loadCA reads the CA from -ca and -ca-key, or creates one and issues leaf
+// certificates from it.
+func loadCA(base string) (*responder.CA, error) {
+	if *caFile != "" {
+		certs, err := helper.ReadCertificates(*caFile)
+		if err != nil {
+			return nil, err
+		}
+		if *caKeyFile == "" {
+			return nil, fmt.Errorf("-ca requires -ca-key")
+		}
+		key, err := responder.ReadKey(*caKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		return &responder.CA{Cert: certs[0], Key: key}, nil
+	}
+
+	ca, err := responder.NewCA("Test OCSP CA")
+	if err != nil {
+		return nil, err
+	}
+	if err := writeCA(ca); err != nil {
+		return nil, err
+	}
+	for i := 1; i <= *leaves; i++ {
+		name := fmt.Sprintf("leaf%d.example.com", i)
+		leaf, err := ca.Issue(big.NewInt(int64(i)), name, base+"/", base+*aiaPath)
+		if err != nil {
+			return nil, err
+		}
+		fileName := filepath.Join(*dir, fmt.Sprintf("leaf%d.pem", i))
+		if err := responder.WriteCertificate(fileName, leaf); err != nil {
+			return nil, err
+		}
+	}
+	log.Printf("wrote CA and %d leaf certificates to %s", *leaves, *dir)
+	return ca, nil
+}
+
+func writeCA(ca *responder.CA) error {
+	if err := responder.WriteCertificate(filepath.Join(*dir, "ca.pem"), ca.Cert); err != nil {
+		return err
+	}
+	return responder.WriteKey(filepath.Join(*dir, "ca-key.pem"), ca.Key)
+}
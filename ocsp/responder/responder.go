@@ -0,0 +1,315 @@
+// Package responder implements an OCSP responder for testing OCSP clients
+// without the internet. It answers GET and POST requests from a table of
+// statuses, signing with a CA key or a delegated responder, serves the
+// issuer certificate for AIA, and can be made to misbehave in the ways real
+// responders do.
+package responder
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+// Fault is a way in which the responder can be told to misbehave.
+type Fault string
+
+const (
+	// FaultStale serves responses whose nextUpdate has already passed.
+	FaultStale Fault = "stale"
+	// FaultWrongSigner signs responses with a key unrelated to the issuer.
+	FaultWrongSigner Fault = "wrong-signer"
+	// FaultMalformed serves a truncated response body.
+	FaultMalformed Fault = "malformed"
+	// FaultServerError answers every OCSP request with HTTP 500.
+	FaultServerError Fault = "5xx"
+	// FaultSlow waits for Responder.Delay before answering.
+	FaultSlow Fault = "slow"
+	// FaultContentType serves responses as text/plain.
+	FaultContentType Fault = "content-type"
+)
+
+// Faults lists every Fault.
+var Faults = []Fault{FaultStale, FaultWrongSigner, FaultMalformed, FaultServerError, FaultSlow, FaultContentType}
+
+// ParseFaults parses a comma-separated list of faults.
+func ParseFaults(s string) (map[Fault]bool, error) {
+	faults := make(map[Fault]bool)
+	for _, name := range strings.Split(s, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		known := false
+		for _, f := range Faults {
+			if Fault(name) == f {
+				known = true
+			}
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown fault %q", name)
+		}
+		faults[Fault(name)] = true
+	}
+	return faults, nil
+}
+
+// Responder is an http.Handler that answers OCSP requests for certificates
+// issued by Issuer. Requests are accepted at any path other than AIAPath:
+// POST with the request as the body, or GET with the URL-encoded base64
+// request as the last path segment (RFC 5019).
+//
+// The exported fields must not be changed once the Responder is serving.
+type Responder struct {
+	// Issuer is the CA the responder answers for.
+	Issuer *x509.Certificate
+	// Signer signs responses. SignerCert is its certificate: Issuer
+	// itself, or a delegated responder certificate issued by it, which is
+	// then included in responses.
+	Signer     crypto.Signer
+	SignerCert *x509.Certificate
+	// Statuses, if non-nil, provides each serial's status. Serials it does
+	// not list, or all serials if it is nil, get DefaultStatus.
+	Statuses      *StatusFile
+	DefaultStatus int
+	// Validity is the time from thisUpdate to nextUpdate. Defaults to four
+	// days.
+	Validity time.Duration
+	// AIAPath, if non-empty, is the path at which Issuer is served in DER.
+	AIAPath string
+	// Faults are the ways in which to misbehave.
+	Faults map[Fault]bool
+	// Delay is how long FaultSlow waits.
+	Delay time.Duration
+
+	mu    sync.Mutex
+	cache map[string]cached
+
+	wrongOnce   sync.Once
+	wrongSigner crypto.Signer
+	wrongCert   *x509.Certificate
+	wrongErr    error
+}
+
+func (r *Responder) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if r.AIAPath != "" && req.URL.Path == r.AIAPath {
+		w.Header().Set("Content-Type", "application/pkix-cert")
+		w.Write(r.Issuer.Raw)
+		return
+	}
+	if r.Faults[FaultSlow] {
+		select {
+		case <-time.After(r.Delay):
+		case <-req.Context().Done():
+			return
+		}
+	}
+	if r.Faults[FaultServerError] {
+		http.Error(w, "internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	var der []byte
+	var err error
+	switch req.Method {
+	case "GET":
+		der, err = getRequest(req.URL)
+	case "POST":
+		der, err = ioutil.ReadAll(req.Body)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err != nil {
+		r.write(w, ocsp.MalformedRequestErrorResponse, time.Time{}, time.Time{})
+		return
+	}
+	ocspReq, err := ocsp.ParseRequest(der)
+	if err != nil {
+		r.write(w, ocsp.MalformedRequestErrorResponse, time.Time{}, time.Time{})
+		return
+	}
+	if !r.issuedBy(ocspReq) {
+		r.write(w, ocsp.UnauthorizedErrorResponse, time.Time{}, time.Time{})
+		return
+	}
+	resp, thisUpdate, nextUpdate, err := r.respond(ocspReq)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if r.Faults[FaultMalformed] {
+		resp = resp[:len(resp)/2]
+	}
+	r.write(w, resp, thisUpdate, nextUpdate)
+}
+
+// getRequest extracts the DER request from a GET URL.
+func getRequest(u *url.URL) ([]byte, error) {
+	path := u.EscapedPath()
+	encoded, err := url.PathUnescape(path[strings.LastIndex(path, "/")+1:])
+	if err != nil {
+		return nil, err
+	}
+	return base64.StdEncoding.DecodeString(encoded)
+}
+
+// issuedBy reports whether req asks about a certificate from r.Issuer.
+// It computes the CertID hashes itself rather than sharing the helper
+// package's issuerHashes: a responder that used the client's code to check
+// the client's requests would agree with any mistake in it.
+func (r *Responder) issuedBy(req *ocsp.Request) bool {
+	if !req.HashAlgorithm.Available() {
+		return false
+	}
+	var spki struct {
+		Algorithm pkix.AlgorithmIdentifier
+		PublicKey asn1.BitString
+	}
+	if _, err := asn1.Unmarshal(r.Issuer.RawSubjectPublicKeyInfo, &spki); err != nil {
+		return false
+	}
+	h := req.HashAlgorithm.New()
+	h.Write(r.Issuer.RawSubject)
+	nameHash := h.Sum(nil)
+	h.Reset()
+	h.Write(spki.PublicKey.RightAlign())
+	keyHash := h.Sum(nil)
+	return bytes.Equal(nameHash, req.IssuerNameHash) && bytes.Equal(keyHash, req.IssuerKeyHash)
+}
+
+// cached is a signed response. Signing is randomized for ECDSA, so without
+// reusing responses, two requests in quick succession would get different
+// bytes for the same thisUpdate, as no real responder serves.
+type cached struct {
+	status     Status
+	thisUpdate time.Time
+	der        []byte
+}
+
+// respond returns a signed response to req, reusing the last one for the
+// same certificate if its status and thisUpdate are unchanged.
+func (r *Responder) respond(req *ocsp.Request) ([]byte, time.Time, time.Time, error) {
+	status := Status{Status: r.DefaultStatus}
+	if r.Statuses != nil {
+		if s, ok := r.Statuses.Lookup(req.SerialNumber); ok {
+			status = s
+		}
+	}
+	validity := r.Validity
+	if validity == 0 {
+		validity = 4 * 24 * time.Hour
+	}
+	// Responses are pre-signed in practice, so thisUpdate is a little in
+	// the past rather than exactly now.
+	thisUpdate := time.Now().Add(-time.Minute).Truncate(time.Minute)
+	if r.Faults[FaultStale] {
+		thisUpdate = thisUpdate.Add(-2 * validity)
+	}
+	nextUpdate := thisUpdate.Add(validity)
+	key := fmt.Sprintf("%x/%d", req.SerialNumber, req.HashAlgorithm)
+	r.mu.Lock()
+	c, ok := r.cache[key]
+	r.mu.Unlock()
+	if ok && c.status == status && c.thisUpdate.Equal(thisUpdate) {
+		return c.der, thisUpdate, nextUpdate, nil
+	}
+
+	template := ocsp.Response{
+		Status:           status.Status,
+		SerialNumber:     req.SerialNumber,
+		ThisUpdate:       thisUpdate,
+		NextUpdate:       nextUpdate,
+		RevokedAt:        status.RevokedAt,
+		RevocationReason: status.Reason,
+		IssuerHash:       req.HashAlgorithm,
+	}
+
+	signer, signerCert := r.Signer, r.SignerCert
+	if r.Faults[FaultWrongSigner] {
+		r.wrongOnce.Do(r.makeWrongSigner)
+		if r.wrongErr != nil {
+			return nil, thisUpdate, nextUpdate, r.wrongErr
+		}
+		signer, signerCert = r.wrongSigner, r.wrongCert
+	}
+	if signerCert != r.Issuer {
+		template.Certificate = signerCert
+	}
+	resp, err := ocsp.CreateResponse(r.Issuer, signerCert, template, signer)
+	if err != nil {
+		return nil, thisUpdate, nextUpdate, err
+	}
+	r.mu.Lock()
+	if r.cache == nil {
+		r.cache = make(map[string]cached)
+	}
+	r.cache[key] = cached{status, thisUpdate, resp}
+	r.mu.Unlock()
+	return resp, thisUpdate, nextUpdate, nil
+}
+
+// makeWrongSigner creates a self-signed responder certificate with no
+// relation to the issuer.
+func (r *Responder) makeWrongSigner() {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		r.wrongErr = err
+		return
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "Wrong OCSP Signer"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageOCSPSigning},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		r.wrongErr = err
+		return
+	}
+	r.wrongCert, r.wrongErr = x509.ParseCertificate(der)
+	r.wrongSigner = key
+}
+
+// write sends resp with the caching headers RFC 5019 section 6 recommends.
+// thisUpdate and nextUpdate are zero for error responses, which get no
+// caching headers.
+func (r *Responder) write(w http.ResponseWriter, resp []byte, thisUpdate, nextUpdate time.Time) {
+	contentType := "application/ocsp-response"
+	if r.Faults[FaultContentType] {
+		contentType = "text/plain"
+	}
+	w.Header().Set("Content-Type", contentType)
+	if !nextUpdate.IsZero() {
+		sum := sha256.Sum256(resp)
+		w.Header().Set("ETag", `"`+hex.EncodeToString(sum[:])+`"`)
+		w.Header().Set("Last-Modified", thisUpdate.UTC().Format(http.TimeFormat))
+		w.Header().Set("Expires", nextUpdate.UTC().Format(http.TimeFormat))
+		if maxAge := time.Until(nextUpdate) / time.Second; maxAge > 0 {
+			w.Header().Set("Cache-Control", fmt.Sprintf("max-age=%d, public, no-transform, must-revalidate", maxAge))
+		} else {
+			w.Header().Set("Cache-Control", "max-age=0, no-cache")
+		}
+	}
+	w.Write(resp)
+}
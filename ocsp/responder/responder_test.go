@@ -0,0 +1,298 @@
+package responder
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/base64"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+// testResponder returns a Responder for a new CA, signing with the CA key,
+// and a leaf certificate it answers for.
+func testResponder(t *testing.T) (*Responder, *x509.Certificate) {
+	t.Helper()
+	ca, err := NewCA("Test CA")
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := ca.Issue(big.NewInt(0x1234), "example.com", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Responder{
+		Issuer:     ca.Cert,
+		Signer:     ca.Key,
+		SignerCert: ca.Cert,
+		AIAPath:    "/issuer",
+		Faults:     make(map[Fault]bool),
+	}, leaf
+}
+
+// post sends an OCSP request for leaf to r by POST and returns the recorded
+// answer.
+func post(t *testing.T, r *Responder, leaf *x509.Certificate) *httptest.ResponseRecorder {
+	t.Helper()
+	der, err := ocsp.CreateRequest(leaf, r.Issuer, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("POST", "/", bytes.NewReader(der)))
+	return w
+}
+
+func TestServe(t *testing.T) {
+	r, leaf := testResponder(t)
+	der, err := ocsp.CreateRequest(leaf, r.Issuer, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	get := "/ocsp/" + url.PathEscape(base64.StdEncoding.EncodeToString(der))
+	for _, req := range []*http.Request{
+		httptest.NewRequest("POST", "/ocsp", bytes.NewReader(der)),
+		httptest.NewRequest("GET", get, nil),
+	} {
+		t.Run(req.Method, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			if w.Code != http.StatusOK {
+				t.Fatalf("HTTP %d", w.Code)
+			}
+			if ct := w.Header().Get("Content-Type"); ct != "application/ocsp-response" {
+				t.Errorf("Content-Type %q", ct)
+			}
+			for _, h := range []string{"ETag", "Last-Modified", "Expires", "Cache-Control"} {
+				if w.Header().Get(h) == "" {
+					t.Errorf("no %s header", h)
+				}
+			}
+			resp, err := ocsp.ParseResponseForCert(w.Body.Bytes(), leaf, r.Issuer)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.Status != ocsp.Good || resp.SerialNumber.Cmp(leaf.SerialNumber) != 0 {
+				t.Errorf("got status %d for serial %x", resp.Status, resp.SerialNumber)
+			}
+		})
+	}
+
+	// A second request in the same minute gets the same bytes.
+	if a, b := post(t, r, leaf).Body.Bytes(), post(t, r, leaf).Body.Bytes(); !bytes.Equal(a, b) {
+		t.Errorf("two requests got different responses")
+	}
+}
+
+func TestServeErrors(t *testing.T) {
+	r, _ := testResponder(t)
+	other, err := NewCA("Other CA")
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherLeaf, err := other.Issue(big.NewInt(1), "example.net", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherReq, err := ocsp.CreateRequest(otherLeaf, other.Cert, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	testCases := []struct {
+		name string
+		req  *http.Request
+		want []byte
+	}{
+		{"garbage", httptest.NewRequest("POST", "/", bytes.NewReader([]byte("garbage"))), ocsp.MalformedRequestErrorResponse},
+		{"bad base64", httptest.NewRequest("GET", "/not%20base64", nil), ocsp.MalformedRequestErrorResponse},
+		{"other issuer", httptest.NewRequest("POST", "/", bytes.NewReader(otherReq)), ocsp.UnauthorizedErrorResponse},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, tc.req)
+			if !bytes.Equal(w.Body.Bytes(), tc.want) {
+				t.Errorf("got %x, want %x", w.Body.Bytes(), tc.want)
+			}
+			if w.Header().Get("Cache-Control") != "" {
+				t.Errorf("error response has Cache-Control %q", w.Header().Get("Cache-Control"))
+			}
+		})
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("PUT", "/", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("PUT got HTTP %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/issuer", nil))
+	if !bytes.Equal(w.Body.Bytes(), r.Issuer.Raw) {
+		t.Errorf("AIA path did not serve the issuer")
+	}
+}
+
+func TestFaults(t *testing.T) {
+	testCases := []struct {
+		fault Fault
+		check func(t *testing.T, w *httptest.ResponseRecorder, leaf, issuer *x509.Certificate)
+	}{
+		{FaultStale, func(t *testing.T, w *httptest.ResponseRecorder, leaf, issuer *x509.Certificate) {
+			resp, err := ocsp.ParseResponseForCert(w.Body.Bytes(), leaf, issuer)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !resp.NextUpdate.Before(time.Now()) {
+				t.Errorf("nextUpdate %s has not passed", resp.NextUpdate)
+			}
+		}},
+		{FaultWrongSigner, func(t *testing.T, w *httptest.ResponseRecorder, leaf, issuer *x509.Certificate) {
+			if _, err := ocsp.ParseResponseForCert(w.Body.Bytes(), leaf, issuer); err == nil {
+				t.Errorf("response verified against the issuer")
+			}
+		}},
+		{FaultMalformed, func(t *testing.T, w *httptest.ResponseRecorder, leaf, issuer *x509.Certificate) {
+			if _, err := ocsp.ParseResponse(w.Body.Bytes(), nil); err == nil {
+				t.Errorf("truncated response parsed")
+			}
+		}},
+		{FaultServerError, func(t *testing.T, w *httptest.ResponseRecorder, leaf, issuer *x509.Certificate) {
+			if w.Code != http.StatusInternalServerError {
+				t.Errorf("HTTP %d, want 500", w.Code)
+			}
+		}},
+		{FaultContentType, func(t *testing.T, w *httptest.ResponseRecorder, leaf, issuer *x509.Certificate) {
+			if ct := w.Header().Get("Content-Type"); ct != "text/plain" {
+				t.Errorf("Content-Type %q, want text/plain", ct)
+			}
+		}},
+	}
+	for _, tc := range testCases {
+		t.Run(string(tc.fault), func(t *testing.T) {
+			r, leaf := testResponder(t)
+			r.Faults[tc.fault] = true
+			tc.check(t, post(t, r, leaf), leaf, r.Issuer)
+		})
+	}
+
+	t.Run(string(FaultSlow), func(t *testing.T) {
+		r, leaf := testResponder(t)
+		r.Faults[FaultSlow] = true
+		r.Delay = 50 * time.Millisecond
+		start := time.Now()
+		w := post(t, r, leaf)
+		if elapsed := time.Since(start); elapsed < r.Delay {
+			t.Errorf("answered after %s, want at least %s", elapsed, r.Delay)
+		}
+		if w.Code != http.StatusOK {
+			t.Errorf("HTTP %d", w.Code)
+		}
+	})
+}
+
+func TestParseFaults(t *testing.T) {
+	faults, err := ParseFaults("stale, 5xx,")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(faults) != 2 || !faults[FaultStale] || !faults[FaultServerError] {
+		t.Errorf("got %v", faults)
+	}
+	if _, err := ParseFaults("stale,bogus"); err == nil {
+		t.Errorf("unknown fault accepted")
+	}
+}
+
+func TestDelegated(t *testing.T) {
+	ca, err := NewCA("Test CA")
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf, err := ca.Issue(big.NewInt(1), "example.com", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, key, err := ca.Delegate("Test OCSP Responder")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &Responder{Issuer: ca.Cert, Signer: key, SignerCert: cert}
+	resp, err := ocsp.ParseResponseForCert(post(t, r, leaf).Body.Bytes(), leaf, ca.Cert)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Certificate == nil || !resp.Certificate.Equal(cert) {
+		t.Errorf("response does not include the delegated responder certificate")
+	}
+}
+
+func TestStatusFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "statuses")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "statuses")
+	contents := "# serial status\n" +
+		"0a good\n" +
+		"0b revoked 1 2024-03-01T12:00:00Z\n" +
+		"0c revoked\n" +
+		"0d:0e unknown # colons are allowed\n"
+	if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+		t.Fatal(err)
+	}
+	f, err := OpenStatusFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	revokedAt, _ := time.Parse(time.RFC3339, "2024-03-01T12:00:00Z")
+	testCases := []struct {
+		serial int64
+		want   Status
+		ok     bool
+	}{
+		{0x0a, Status{Status: ocsp.Good}, true},
+		{0x0b, Status{Status: ocsp.Revoked, Reason: 1, RevokedAt: revokedAt}, true},
+		{0x0d0e, Status{Status: ocsp.Unknown}, true},
+		{0x0f, Status{}, false},
+	}
+	for _, tc := range testCases {
+		got, ok := f.Lookup(big.NewInt(tc.serial))
+		if ok != tc.ok || got != tc.want {
+			t.Errorf("%x: got %+v, %t, want %+v, %t", tc.serial, got, ok, tc.want, tc.ok)
+		}
+	}
+	if got, _ := f.Lookup(big.NewInt(0x0c)); got.Status != ocsp.Revoked || got.RevokedAt.IsZero() {
+		t.Errorf("revoked without a time: got %+v, want the time the file was read", got)
+	}
+
+	// The responder answers from the file, and falls back to DefaultStatus.
+	r, leaf := testResponder(t)
+	r.Statuses = f
+	r.DefaultStatus = ocsp.Unknown
+	resp, err := ocsp.ParseResponseForCert(post(t, r, leaf).Body.Bytes(), leaf, r.Issuer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Status != ocsp.Unknown {
+		t.Errorf("unlisted serial got status %d, want unknown", resp.Status)
+	}
+
+	for _, bad := range []string{"0a\n", "zz good\n", "0a fine\n", "0a good 1\n", "0a revoked one\n", "0a revoked 1 yesterday\n"} {
+		if err := ioutil.WriteFile(path, []byte(bad), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := OpenStatusFile(path); err == nil {
+			t.Errorf("%q accepted", bad)
+		}
+	}
+}
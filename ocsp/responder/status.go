@@ -0,0 +1,160 @@
+package responder
+
+import (
+	"bufio"
+	"fmt"
+	"math/big"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+// Status is the answer the responder gives for one serial number.
+type Status struct {
+	// Status is ocsp.Good, ocsp.Revoked or ocsp.Unknown.
+	Status int
+	// Reason and RevokedAt are only used when Status is ocsp.Revoked.
+	Reason    int
+	RevokedAt time.Time
+}
+
+// StatusFile maps serial numbers to statuses, as read from a text file with
+// one serial per line:
+//
+//	# serial (hex)  status   [reason] [revocation time, RFC 3339]
+//	0a1b2c          good
+//	0a1b2d          revoked  1        2024-03-01T12:00:00Z
+//	0a1b2e          unknown
+//
+// The revocation time defaults to when the file was read. The file is read
+// again whenever it changes, so statuses can be altered while the responder
+// runs.
+type StatusFile struct {
+	path string
+
+	mu       sync.Mutex
+	modTime  time.Time
+	statuses map[string]Status
+}
+
+// OpenStatusFile reads the status file at path.
+func OpenStatusFile(path string) (*StatusFile, error) {
+	f := &StatusFile{path: path}
+	if err := f.reload(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Lookup returns the status of serial, and whether the file lists it. If the
+// file has changed but can no longer be parsed, the previous contents are
+// used.
+func (f *StatusFile) Lookup(serial *big.Int) (Status, bool) {
+	f.reload()
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	status, ok := f.statuses[serial.Text(16)]
+	return status, ok
+}
+
+func (f *StatusFile) reload() error {
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return err
+	}
+	f.mu.Lock()
+	unchanged := f.statuses != nil && info.ModTime().Equal(f.modTime)
+	f.mu.Unlock()
+	if unchanged {
+		return nil
+	}
+	statuses, err := readStatuses(f.path)
+	if err != nil {
+		return err
+	}
+	f.mu.Lock()
+	f.statuses = statuses
+	f.modTime = info.ModTime()
+	f.mu.Unlock()
+	return nil
+}
+
+func readStatuses(path string) (map[string]Status, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	statuses := make(map[string]Status)
+	scanner := bufio.NewScanner(file)
+	for lineNum := 1; scanner.Scan(); lineNum++ {
+		line := scanner.Text()
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		serial, status, err := parseStatusLine(fields)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %s", path, lineNum, err)
+		}
+		statuses[serial.Text(16)] = status
+	}
+	return statuses, scanner.Err()
+}
+
+func parseStatusLine(fields []string) (*big.Int, Status, error) {
+	var status Status
+	if len(fields) < 2 {
+		return nil, status, fmt.Errorf("expected serial and status")
+	}
+	serial, ok := new(big.Int).SetString(strings.Replace(fields[0], ":", "", -1), 16)
+	if !ok {
+		return nil, status, fmt.Errorf("invalid serial %q", fields[0])
+	}
+	var err error
+	status.Status, err = ParseStatus(fields[1])
+	if err != nil {
+		return nil, status, err
+	}
+	if status.Status != ocsp.Revoked {
+		if len(fields) > 2 {
+			return nil, status, fmt.Errorf("unexpected fields after %s", fields[1])
+		}
+		return serial, status, nil
+	}
+	status.RevokedAt = time.Now()
+	if len(fields) > 2 {
+		if status.Reason, err = strconv.Atoi(fields[2]); err != nil {
+			return nil, status, fmt.Errorf("invalid reason %q", fields[2])
+		}
+	}
+	if len(fields) > 3 {
+		if status.RevokedAt, err = time.Parse(time.RFC3339, fields[3]); err != nil {
+			return nil, status, fmt.Errorf("invalid revocation time %q", fields[3])
+		}
+	}
+	if len(fields) > 4 {
+		return nil, status, fmt.Errorf("unexpected fields after revocation time")
+	}
+	return serial, status, nil
+}
+
+// ParseStatus parses "good", "revoked" or "unknown".
+func ParseStatus(s string) (int, error) {
+	switch strings.ToLower(s) {
+	case "good":
+		return ocsp.Good, nil
+	case "revoked":
+		return ocsp.Revoked, nil
+	case "unknown":
+		return ocsp.Unknown, nil
+	}
+	return 0, fmt.Errorf("invalid status %q, expected good, revoked or unknown", s)
+}